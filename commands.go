@@ -0,0 +1,494 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/SimplicityApks/depgrapher/graph"
+	"github.com/SimplicityApks/depgrapher/query"
+	"github.com/SimplicityApks/depgrapher/rules"
+	"github.com/SimplicityApks/depgrapher/server"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// loadWithNodes loads the graph from the files following the given number of node arguments, and returns an error
+// if one of the nodes isn't in the graph.
+func loadWithNodes(in *inputFlags, args []string, nodes int) (*graph.Graph, error) {
+	g, err := in.load(args[nodes:])
+	if err != nil {
+		return nil, err
+	}
+	if err := checkNodes(g, args[:nodes]); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// checkNodes returns an error for the first of the given nodes that isn't in g.
+func checkNodes(g graph.Interface, names []string) error {
+	for _, name := range names {
+		if g.GetNode(name) == nil {
+			return errorf(exitNotFound, "node %q not found", name)
+		}
+	}
+	return nil
+}
+
+// writeText writes the output of a text command to the file given by -outfile, or stdout.
+func writeText(outfile string, write func(w io.Writer) error) error {
+	writer, closeOutput, err := openOutput(outfile)
+	if err != nil {
+		return err
+	}
+	err = write(writer)
+	if closeErr := closeOutput(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// formatPath returns the names of nodes joined by arrows.
+func formatPath(nodes []graph.Node) string {
+	names := make([]string, len(nodes))
+	for i, n := range nodes {
+		names[i] = n.String()
+	}
+	return strings.Join(names, " -> ")
+}
+
+func runRender(fs *flag.FlagSet, args []string) error {
+	in, out := addInputFlags(fs), addOutputFlags(fs)
+	node := fs.String("node", "", "Name of the node whose dependency graph should be rendered. Defaults to all nodes.")
+	highlight := fs.Bool("highlight", false, "Highlight -node and its dependencies in the complete graph instead of only rendering its dependency graph, only for dot output")
+	args, err := parseArgs(fs, args, 0)
+	if err != nil {
+		return err
+	}
+	return out.render(in, args, func(g *graph.Graph) error {
+		if *node == "" {
+			return out.write(g, "", "")
+		}
+		if g.GetNode(*node) == nil {
+			return errorf(exitNotFound, "node %q not found", *node)
+		}
+		if *highlight {
+			return out.write(g, *node, *node)
+		}
+		return out.write(g.GetDependencyGraph(*node), *node, "")
+	})
+}
+
+func runDeps(fs *flag.FlagSet, args []string) error {
+	in, out := addInputFlags(fs), addOutputFlags(fs)
+	args, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	return out.render(in, args[1:], func(g *graph.Graph) error {
+		if err := checkNodes(g, args[:1]); err != nil {
+			return err
+		}
+		return out.write(g.GetDependencyGraph(args[0]), args[0], "")
+	})
+}
+
+func runRdeps(fs *flag.FlagSet, args []string) error {
+	in, out := addInputFlags(fs), addOutputFlags(fs)
+	args, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	return out.render(in, args[1:], func(g *graph.Graph) error {
+		if err := checkNodes(g, args[:1]); err != nil {
+			return err
+		}
+		return out.write(graph.Subgraph(g, graph.DependantClosure(g, args[0])), "", "")
+	})
+}
+
+func runQuery(fs *flag.FlagSet, args []string) error {
+	in, out := addInputFlags(fs), addOutputFlags(fs)
+	in.markPhony = true
+	args, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	q, err := query.Parse(args[0])
+	if err != nil {
+		return withCode(exitUsage, err)
+	}
+	return out.render(in, args[1:], func(g *graph.Graph) error {
+		nodes := q.Select(g)
+		if len(nodes) == 0 {
+			return errorf(exitNotFound, "no nodes match %s", q)
+		}
+		return out.write(graph.Subgraph(g, nodes), "", "")
+	})
+}
+
+func runAffected(fs *flag.FlagSet, args []string) error {
+	in := addInputFlags(fs)
+	in.markPhony = true
+	var outfile string
+	addOutfileFlag(fs, &outfile)
+	changed := fs.String("changed", "-", "File listing the changed nodes one per line, e.g. from git diff --name-only, or - for stdin")
+	match := fs.String("match", "", "Only print the affected nodes matching the glob pattern, e.g. 'test-*'")
+	roots := fs.Bool("roots", false, "Only print the affected nodes without dependants")
+	args, err := parseArgs(fs, args, 0)
+	if err != nil {
+		return err
+	}
+	if *changed == "-" && len(args) == 0 && in.scan == "" {
+		return usageErrorf("the graph can't be read from stdin if -changed is read from stdin")
+	}
+	names, err := readLines(*changed)
+	if err != nil {
+		return withCode(exitParse, err)
+	}
+	g, err := in.load(args)
+	if err != nil {
+		return err
+	}
+	affected := graph.Affected(g, names, func(name string) bool {
+		return (*match == "" || graph.MatchGlob(*match, name)) && (!*roots || len(g.GetDependants(name)) == 0)
+	})
+	return writeText(outfile, func(w io.Writer) error {
+		for _, n := range affected {
+			if _, err := fmt.Fprintln(w, n.String()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// readLines returns the non-empty lines of the file with the given name, or of stdin if the name is "-", without
+// surrounding whitespace.
+func readLines(filename string) ([]string, error) {
+	reader := io.Reader(os.Stdin)
+	if filename != "-" {
+		file, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		reader = file
+	}
+	var lines []string
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+func runRun(fs *flag.FlagSet, args []string) error {
+	in := addInputFlags(fs)
+	in.markPhony = true
+	var targets stringList
+	fs.Var(&targets, "target", "Target to run with its dependencies instead of all nodes, can be given multiple times")
+	jobs := fs.Int("j", runtime.NumCPU(), "Maximum number of nodes run in parallel")
+	keepGoing := fs.Bool("k", false, "Keep running the nodes that don't depend on a failed node")
+	dryRun := fs.Bool("n", false, "Print the schedule of the commands without running them")
+	timeout := fs.Duration("timeout", 0, "Maximum duration of the commands of a single node, e.g. 30s, 0 for no limit")
+	template := fs.String("command", "", "Command run for every node except phony targets instead of the recipes, with the make variables $@, $< and $^")
+	args, err := parseArgs(fs, args, 0)
+	if err != nil {
+		return err
+	}
+	g, err := in.load(args)
+	if err != nil {
+		return err
+	}
+	for _, target := range targets {
+		if g.GetNode(target) == nil {
+			return errorf(exitNotFound, "target %q not found", target)
+		}
+	}
+	opts := graph.ExecOptions{Jobs: *jobs, KeepGoing: *keepGoing, DryRun: *dryRun, Timeout: *timeout, Output: os.Stdout}
+	if *template != "" {
+		opts.Commands = graph.TemplateCommands(*template)
+	}
+	err = graph.Execute(context.Background(), g, targets, opts)
+	var execErr *graph.ExecError
+	if errors.As(err, &execErr) {
+		return withCode(exitFailed, err)
+	}
+	return err
+}
+
+func runStale(fs *flag.FlagSet, args []string) error {
+	in := addInputFlags(fs)
+	in.markPhony = true
+	var outfile string
+	addOutfileFlag(fs, &outfile)
+	dir := fs.String("dir", ".", "Directory the node names are relative to")
+	asJSON := fs.Bool("json", false, "Write the stale targets and missing prerequisites as JSON")
+	args, err := parseArgs(fs, args, 0)
+	if err != nil {
+		return err
+	}
+	g, err := in.load(args)
+	if err != nil {
+		return err
+	}
+	result := graph.FindStale(g, graph.FileModTime(*dir))
+	err = writeText(outfile, func(w io.Writer) error {
+		if *asJSON {
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(result)
+		}
+		return result.WriteText(w)
+	})
+	if err == nil && len(result.Stale)+len(result.Missing) > 0 {
+		return errorf(exitFailed, "found %d stale targets and %d missing prerequisites", len(result.Stale),
+			len(result.Missing))
+	}
+	return err
+}
+
+func runServe(fs *flag.FlagSet, args []string) error {
+	in := addInputFlags(fs)
+	addr := fs.String("addr", "localhost:8080", "Address to listen on, e.g. :8080 for all interfaces")
+	args, err := parseArgs(fs, args, 0)
+	if err != nil {
+		return err
+	}
+	g, err := in.load(args)
+	if err != nil {
+		return err
+	}
+	synced := graph.NewSynced()
+	synced.Replace(g)
+	// the graph can only be reloaded from files, stdin has already been read
+	var load func() (*graph.Graph, error)
+	if len(args) > 0 || in.scan != "" {
+		load = func() (*graph.Graph, error) { return in.load(args) }
+	}
+	fmt.Fprintf(os.Stderr, "depgrapher: serving %d nodes on %s\n", len(g.GetNodes()), *addr)
+	return http.ListenAndServe(*addr, server.New(synced, load))
+}
+
+func runPath(fs *flag.FlagSet, args []string) error {
+	in := addInputFlags(fs)
+	var outfile string
+	addOutfileFlag(fs, &outfile)
+	args, err := parseArgs(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	g, err := loadWithNodes(in, args, 2)
+	if err != nil {
+		return err
+	}
+	path := graph.ShortestPath(g, args[0], args[1])
+	if path == nil {
+		return errorf(exitNotFound, "%q doesn't depend on %q", args[0], args[1])
+	}
+	return writeText(outfile, func(w io.Writer) error {
+		_, err := fmt.Fprintln(w, formatPath(path))
+		return err
+	})
+}
+
+func runCycles(fs *flag.FlagSet, args []string) error {
+	in := addInputFlags(fs)
+	var outfile string
+	addOutfileFlag(fs, &outfile)
+	args, err := parseArgs(fs, args, 0)
+	if err != nil {
+		return err
+	}
+	g, err := in.load(args)
+	if err != nil {
+		return err
+	}
+	return writeText(outfile, func(w io.Writer) error {
+		for i, cycle := range graph.Cycles(g) {
+			names := make([]string, len(cycle))
+			for j, n := range cycle {
+				names[j] = n.String()
+			}
+			start := cycle[0].String()
+			if _, err := fmt.Fprintf(w, "cycle %d: %s\n  %s\n", i+1, strings.Join(names, " "),
+				formatPath(graph.ShortestPath(g, start, start))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func runOrder(fs *flag.FlagSet, args []string) error {
+	in := addInputFlags(fs)
+	in.markPhony = true
+	var outfile string
+	addOutfileFlag(fs, &outfile)
+	args, err := parseArgs(fs, args, 0)
+	if err != nil {
+		return err
+	}
+	g, err := in.load(args)
+	if err != nil {
+		return err
+	}
+	if cycles := graph.Cycles(g); len(cycles) > 0 {
+		fmt.Fprintf(os.Stderr, "depgrapher order: warning: the graph contains %d cycles, their nodes are ordered "+
+			"as declared\n", len(cycles))
+	}
+	return writeText(outfile, func(w io.Writer) error {
+		for _, n := range graph.Sorted(g, graph.TopologicalOrder).GetNodes() {
+			if _, err := fmt.Fprintln(w, n.String()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func runStats(fs *flag.FlagSet, args []string) error {
+	in := addInputFlags(fs)
+	in.markPhony = true
+	var outfile string
+	addOutfileFlag(fs, &outfile)
+	asJSON := fs.Bool("json", false, "Write the statistics as JSON")
+	top := fs.Int("top", 10, "Number of nodes in the rankings of the most depended on nodes and the nodes with the most dependants, negative for all")
+	args, err := parseArgs(fs, args, 0)
+	if err != nil {
+		return err
+	}
+	g, err := in.load(args)
+	if err != nil {
+		return err
+	}
+	stats := graph.Stats(g)
+	stats.Limit(*top)
+	return writeText(outfile, func(w io.Writer) error {
+		if *asJSON {
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(stats)
+		}
+		return stats.WriteText(w)
+	})
+}
+
+func runDiff(fs *flag.FlagSet, args []string) error {
+	in := addInputFlags(fs)
+	var outfile string
+	addOutfileFlag(fs, &outfile)
+	args, err := parseArgs(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	if len(args) > 2 {
+		return usageErrorf("diff expects exactly two inputs")
+	}
+	old, err := in.load(args[:1])
+	if err != nil {
+		return err
+	}
+	updated, err := in.load(args[1:])
+	if err != nil {
+		return err
+	}
+	lines := diffLines(old, updated)
+	err = writeText(outfile, func(w io.Writer) error {
+		for _, line := range lines {
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil && len(lines) > 0 {
+		return &exitCodeError{code: exitFailed}
+	}
+	return err
+}
+
+// diffLines returns the nodes and edges removed from old prefixed with "-", followed by the ones added in updated
+// prefixed with "+".
+func diffLines(old, updated graph.Interface) []string {
+	var lines []string
+	// missingNodes and missingEdges add the nodes and edges of a that aren't in b with the given prefix
+	missingNodes := func(a, b graph.Interface, prefix string) {
+		for _, n := range a.GetNodes() {
+			if b.GetNode(n.String()) == nil {
+				lines = append(lines, prefix+" "+n.String())
+			}
+		}
+	}
+	missingEdges := func(a, b graph.Interface, prefix string) {
+		for _, n := range a.GetNodes() {
+			for _, dep := range a.GetDependencies(n.String()) {
+				if !b.HasEdge(n.String(), dep.String()) {
+					lines = append(lines, prefix+" "+n.String()+" -> "+dep.String())
+				}
+			}
+		}
+	}
+	missingNodes(old, updated, "-")
+	missingNodes(updated, old, "+")
+	missingEdges(old, updated, "-")
+	missingEdges(updated, old, "+")
+	return lines
+}
+
+func runCheck(fs *flag.FlagSet, args []string) error {
+	in := addInputFlags(fs)
+	in.markPhony = true
+	var outfile string
+	addOutfileFlag(fs, &outfile)
+	rulesFile := fs.String("rules", "", "File with the architecture rules to check, see the README for the format. Defaults to checking for cycles.")
+	args, err := parseArgs(fs, args, 0)
+	if err != nil {
+		return err
+	}
+	var checked []*rules.Rule
+	if *rulesFile == "" {
+		rule, _ := rules.ParseRule("no cycles")
+		checked = []*rules.Rule{rule}
+	} else {
+		file, err := os.Open(*rulesFile)
+		if err != nil {
+			return withCode(exitParse, err)
+		}
+		checked, err = rules.Parse(file)
+		file.Close()
+		if err != nil {
+			return errorf(exitParse, "%s: %v", *rulesFile, err)
+		}
+	}
+	g, err := in.load(args)
+	if err != nil {
+		return err
+	}
+	violations := rules.Check(g, checked)
+	err = writeText(outfile, func(w io.Writer) error {
+		for _, violation := range violations {
+			if _, err := fmt.Fprintln(w, violation); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil && len(violations) > 0 {
+		return errorf(exitFailed, "found %d violations", len(violations))
+	}
+	return err
+}
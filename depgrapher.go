@@ -5,70 +5,228 @@
 package main
 
 import (
-	"bufio"
+	"errors"
 	"flag"
-	"github.com/SimplicityApks/depgrapher/graph"
-	"github.com/SimplicityApks/depgrapher/syntax"
+	"fmt"
 	"io"
 	"os"
+	"strings"
 )
 
-// parseFiles parses the given files with the given syntaxes and returns the generated graphs
-func parseFiles(filenames []string, syntax ...*syntax.Syntax) (g graph.Interface, err error) {
-	readers := make([]io.Reader, len(filenames))
-	for index, filename := range filenames {
-		readers[index], err = os.Open(filename)
-		if err != nil {
-			return nil, err
+// The exit codes of depgrapher.
+const (
+	exitOK       = 0
+	exitFailure  = 1 // any other error, e.g. an output file that can't be written
+	exitUsage    = 2 // invalid command, flags or arguments
+	exitParse    = 3 // the input couldn't be read or parsed
+	exitNotFound = 4 // a queried node or path doesn't exist
+	exitFailed   = 5 // check found violations, diff found differences, run had failed nodes or stale found stale targets
+)
+
+// exitCodeError is an error that makes depgrapher exit with the given code. An exitCodeError without err has
+// already been reported to the user.
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+func (e *exitCodeError) Error() string {
+	if e.err == nil {
+		return fmt.Sprintf("exit code %d", e.code)
+	}
+	return e.err.Error()
+}
+
+// withCode returns err with the given exit code, or nil if err is nil.
+func withCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitCodeError{code: code, err: err}
+}
+
+// errorf returns a new error with the given exit code.
+func errorf(code int, format string, args ...interface{}) error {
+	return &exitCodeError{code: code, err: fmt.Errorf(format, args...)}
+}
+
+// usageErrorf returns a new error for invalid usage.
+func usageErrorf(format string, args ...interface{}) error {
+	return errorf(exitUsage, format, args...)
+}
+
+// command is a subcommand of depgrapher.
+type command struct {
+	name string
+	// arguments describes the positional arguments in the usage text
+	arguments   string
+	description string
+	// run registers the flags of the command on fs, parses args and runs the command
+	run func(fs *flag.FlagSet, args []string) error
+}
+
+// commands contains all subcommands of depgrapher in the order of the usage text. It is filled in init to avoid an
+// initialization loop with the help command.
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"render", "[file...]", "Render the whole graph, or the dependency graph of -node.", runRender},
+		{"deps", "NODE [file...]", "Render NODE and all nodes it depends on directly or indirectly.", runDeps},
+		{"rdeps", "NODE [file...]", "Render NODE and all nodes depending on it directly or indirectly.", runRdeps},
+		{"query", "EXPR [file...]", "Render the nodes selected by the query EXPR, see the README for the syntax.", runQuery},
+		{"affected", "[file...]", "Print the changed nodes of -changed and all nodes depending on them.", runAffected},
+		{"path", "FROM TO [file...]", "Print a shortest chain of dependencies from FROM to TO.", runPath},
+		{"cycles", "[file...]", "Print the dependency cycles of the graph.", runCycles},
+		{"order", "[file...]", "Print the nodes in build order, each node after its dependencies.", runOrder},
+		{"stats", "[file...]", "Print statistics about the graph.", runStats},
+		{"diff", "OLD NEW", "Print the nodes and edges added and removed between two inputs.", runDiff},
+		{"check", "[file...]", "Check the graph against the architecture rules of -rules, or for dependency cycles.", runCheck},
+		{"run", "[file...]", "Run the recipes or -command of the nodes in dependency order in parallel.", runRun},
+		{"stale", "[file...]", "Print the targets whose files are older than their prerequisites, like make.", runStale},
+		{"serve", "[file...]", "Serve the queries of the graph as JSON over HTTP on -addr.", runServe},
+		{"help", "[command]", "Print the usage of depgrapher or of a command.", runHelp},
+	}
+}
+
+// findCommand returns the command with the given name, or nil if there is none.
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
 		}
 	}
-	scanner := bufio.NewScanner(io.MultiReader(readers...))
-	return graph.New().FromScanner(scanner, syntax...)
+	return nil
 }
 
-func main() {
-	// declare flags
-	syntaxString := flag.String("syntax", "Makefile,Dot", "Syntax to be used to parse the file")
-	outfilename := flag.String("outfile", "", "File to write a dot representation of the dependency tree")
-	startNode := flag.String("node", "", "Name of the node for wich the dependency graph should be printed. Defaults to all nodes.")
-	flag.Parse()
-	filenames := flag.Args()
-	s, err := syntax.Parse(*syntaxString)
-	if err != nil {
-		panic(err)
+// flagSet returns a new flag set for cmd, printing errors and the usage text of cmd to stderr.
+func (cmd *command) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("depgrapher "+cmd.name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	fs.Usage = func() { cmd.printUsage(fs) }
+	return fs
+}
+
+// printUsage prints the usage text of cmd including the flags registered on fs.
+func (cmd *command) printUsage(fs *flag.FlagSet) {
+	fmt.Fprintf(fs.Output(), "Usage: depgrapher %s [flags] %s\n\n%s\n", cmd.name, cmd.arguments, cmd.description)
+	hasFlags := false
+	fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+	if hasFlags {
+		fmt.Fprintf(fs.Output(), "\nFlags:\n")
+		fs.PrintDefaults()
 	}
-	var i graph.Interface
-	i, err = parseFiles(filenames, s...)
-	if err != nil {
-		panic(err)
-	}
-	g := i.(*graph.Graph)
-	if *outfilename == "stdout" {
-		if *startNode == "" {
-			graph.WriteDot(g, os.Stdout)
-		} else {
-			graph.WriteDot(g.GetDependencyGraph(*startNode), os.Stdout)
+}
+
+// parseArgs parses args with fs, allowing flags after the positional arguments, and returns the positional arguments.
+// It returns an error if there are less than required positional arguments.
+func parseArgs(fs *flag.FlagSet, args []string, required int) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if err == flag.ErrHelp {
+				return nil, &exitCodeError{code: exitOK}
+			}
+			// the flag package has already printed the error and the usage
+			return nil, &exitCodeError{code: exitUsage}
 		}
-	} else if *outfilename != "" {
-		outfile, err := os.Create(*outfilename)
-		if err != nil {
-			panic(err)
+		args = fs.Args()
+		if len(args) == 0 {
+			break
 		}
-		if *startNode == "" {
-			graph.WriteDot(g, outfile)
-		} else {
-			graph.WriteDot(g.GetDependencyGraph(*startNode), outfile)
+		positional, args = append(positional, args[0]), args[1:]
+	}
+	if len(positional) < required {
+		fmt.Fprintf(fs.Output(), "%s: missing arguments\n", fs.Name())
+		fs.Usage()
+		return nil, &exitCodeError{code: exitUsage}
+	}
+	return positional, nil
+}
+
+// printUsage prints the usage text of depgrapher to writer.
+func printUsage(writer io.Writer) {
+	fmt.Fprintf(writer, "Usage: depgrapher <command> [flags] [arguments]\n\n"+
+		"depgrapher reads dependency graphs from build files or source code to render and query them.\n"+
+		"Without any files, the graph is read from stdin. Without a command, depgrapher runs render.\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(writer, "  %-8s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintf(writer, "\nRun 'depgrapher help <command>' for the flags of a command.\n\n"+
+		"Exit codes:\n"+
+		"  %d  success\n  %d  error\n  %d  invalid usage\n  %d  unreadable input\n  %d  node or path not found\n"+
+		"  %d  check failed, inputs differ, run failed or targets are stale\n", exitOK, exitFailure, exitUsage, exitParse, exitNotFound, exitFailed)
+}
+
+func runHelp(fs *flag.FlagSet, args []string) error {
+	args, err := parseArgs(fs, args, 0)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		printUsage(os.Stdout)
+		return nil
+	}
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		return usageErrorf("unknown command: %s", args[0])
+	}
+	// let the command register its flags and print its usage to stdout
+	helpFlags := cmd.flagSet()
+	helpFlags.SetOutput(os.Stdout)
+	cmd.run(helpFlags, []string{"-h"})
+	return nil
+}
+
+// run runs depgrapher with the given arguments and returns its exit code. If the first argument is a flag or an
+// existing file instead of a command, the arguments are passed to render, which keeps the flags of the previous versions
+// of depgrapher working. Without any arguments, render reads the graph from stdin.
+func run(args []string) int {
+	var cmd *command
+	if len(args) > 0 {
+		cmd = findCommand(args[0])
+	}
+	var err error
+	switch {
+	case len(args) > 0 && (args[0] == "-h" || args[0] == "-help" || args[0] == "--help"):
+		printUsage(os.Stdout)
+		return exitOK
+	case cmd != nil:
+		args = args[1:]
+	case len(args) == 0 || strings.HasPrefix(args[0], "-") || fileExists(args[0]):
+		cmd = findCommand("render")
+	default:
+		err = usageErrorf("unknown command: %s", args[0])
+	}
+	if err == nil {
+		err = cmd.run(cmd.flagSet(), args)
+	}
+	if err == nil {
+		return exitOK
+	}
+	var codeErr *exitCodeError
+	if !errors.As(err, &codeErr) {
+		codeErr = &exitCodeError{code: exitFailure, err: err}
+	}
+	if codeErr.err != nil {
+		name := ""
+		if cmd != nil {
+			name = " " + cmd.name
 		}
-	} else {
-		// write ascii graph to stdout
-		if *startNode == "" {
-			graph.PrintFullDepTree(g)
-		} else {
-			start := g.GetNode(*startNode)
-			if start == nil {
-				panic("Starting node with name " + *startNode + "not found!")
-			}
-			graph.PrintDepTree(g, start)
+		fmt.Fprintf(os.Stderr, "depgrapher%s: %v\n", name, codeErr.err)
+		if codeErr.code == exitUsage {
+			fmt.Fprintf(os.Stderr, "Run 'depgrapher help%s' for usage.\n", name)
 		}
 	}
+	return codeErr.code
+}
+
+// fileExists returns true if a file or directory with the given name exists.
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
 }
@@ -0,0 +1,108 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun_exitCodes(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"Makefile": "all: build install\nbuild: main.o\ninstall: build\n",
+		"changed":  "all: build\nbuild: main.o\n",
+		"cyclic":   "a: b\nb: a\n",
+		"phony":    "app: deprecated/old\n.PHONY: deprecated/old\n",
+		"rules":    "* - app must not depend on *\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	makefile, changed, cyclic := filepath.Join(dir, "Makefile"), filepath.Join(dir, "changed"), filepath.Join(dir, "cyclic")
+	phony, rulesFile := filepath.Join(dir, "phony"), filepath.Join(dir, "rules")
+	out := filepath.Join(dir, "out")
+	tests := []struct {
+		args     []string
+		expected int
+	}{
+		{[]string{"-h"}, exitOK},
+		{[]string{"help", "render"}, exitOK},
+		{[]string{"render", "-outfile", out, makefile}, exitOK},
+		{[]string{"-outfile", out, makefile}, exitOK},
+		{[]string{"deps", "-outfile", out, "build", makefile}, exitOK},
+		{[]string{"diff", "-outfile", out, makefile, makefile}, exitOK},
+		{[]string{"check", "-outfile", out, makefile}, exitOK},
+		{[]string{"check", "-outfile", out, "-rules", rulesFile, phony}, exitOK},
+		{[]string{"unknown"}, exitUsage},
+		{[]string{"rendr", makefile}, exitUsage},
+		{[]string{"help", "unknown"}, exitUsage},
+		{[]string{"render", "-unknown"}, exitUsage},
+		{[]string{"deps"}, exitUsage},
+		{[]string{"render", "-sort", "unknown", makefile}, exitUsage},
+		{[]string{"render", "-format", "unknown", makefile}, exitUsage},
+		{[]string{"diff", makefile, makefile, makefile}, exitUsage},
+		{[]string{"render", "-watch", "-interval", "0", makefile}, exitUsage},
+		{[]string{"render", "-watch", "-interval", "-1s", makefile}, exitUsage},
+		{[]string{"render", filepath.Join(dir, "missing")}, exitParse},
+		{[]string{"deps", "missing", makefile}, exitNotFound},
+		{[]string{"path", "main.o", "all", makefile}, exitNotFound},
+		{[]string{"query", "missing", makefile}, exitNotFound},
+		{[]string{"check", "-outfile", out, cyclic}, exitFailed},
+		{[]string{"diff", "-outfile", out, makefile, changed}, exitFailed},
+	}
+	for _, test := range tests {
+		if code := run(test.args); code != test.expected {
+			t.Errorf("run(%q) returned %d instead of %d", test.args, code, test.expected)
+		}
+	}
+
+	// the queries don't see the special target .PHONY
+	if code := run([]string{"query", "-outfile", out, "roots()", phony}); code != exitOK {
+		t.Errorf("run query returned %d instead of %d", code, exitOK)
+	}
+	if data, err := os.ReadFile(out); err != nil || strings.Contains(string(data), ".PHONY") {
+		t.Errorf("query 'roots()' wrote %q: %v", data, err)
+	}
+
+	// without any arguments, the graph is read from stdin
+	file, err := os.Open(makefile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	stdin := os.Stdin
+	defer func() { os.Stdin = stdin }()
+	os.Stdin = file
+	if code := run(nil); code != exitOK {
+		t.Errorf("run without arguments returned %d instead of %d", code, exitOK)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	makefile, out := filepath.Join(dir, "Makefile"), filepath.Join(dir, "graph.dot")
+	if err := os.WriteFile(makefile, []byte("a: b\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	excluded, _ := filepath.Abs(out)
+	before := fingerprint([]string{dir}, excluded)
+	if err := os.WriteFile(out, []byte("digraph{}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if after := fingerprint([]string{dir}, excluded); after != before {
+		t.Errorf("writing the output file changed the fingerprint from\n%s to\n%s", before, after)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "other.mk"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if after := fingerprint([]string{dir}, excluded); after == before {
+		t.Error("adding a file didn't change the fingerprint")
+	}
+}
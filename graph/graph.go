@@ -13,6 +13,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/SimplicityApks/depgrapher/syntax"
+	"sort"
 	"strings"
 )
 
@@ -49,15 +50,34 @@ type Interface interface {
 	Copy() Interface
 }
 
+// Attributed is implemented by graphs that can store string attributes like a "label" for their nodes and edges.
+// The output functions write these attributes for every graph implementing it, like graph.Graph.
+type Attributed interface {
+	// NodeAttributes returns the attributes of the Node with the given name, or nil if it doesn't have any.
+	NodeAttributes(name string) map[string]string
+	// EdgeAttributes returns the attributes of the edge from the source Node to the target Node, or nil if it doesn't
+	// have any.
+	EdgeAttributes(source, target string) map[string]string
+}
+
 // Graph represents the dependency graph in memory. Reades and writes at the same time are not concurrency-safe and
 // therefore need to be synchronized. Checkout graph.Synced for a thread-safe version of Graph.
 // It satisfies the graph.Interface and fmt.Stringer interfaces.
 // The zero value is an uninitialized graph, use graph.New() to get an initialized Graph.
 //
+// Graph remembers the order in which its nodes were declared, i.e. first added. All methods returning nodes return
+// them in declaration order, which makes the output functions deterministic. Use graph.Sorted to reorder a Graph.
+//
 // This implementation prefers fast node lookups and edge removals over dependency lookups.
 type Graph struct {
 	nodes map[string]Node
 	edges map[edge]struct{}
+	// order contains the declaration index of each node, nextOrder is the index of the next declared node
+	order     map[string]uint
+	nextOrder uint
+	// attributes are only allocated once they are set
+	nodeAttrs map[string]map[string]string
+	edgeAttrs map[edge]map[string]string
 }
 
 // node is a simple string type, created only by the Graph input methods.
@@ -67,6 +87,11 @@ func (s node) String() string {
 	return string(s)
 }
 
+// NewNode returns a simple Node identified by the given name, as created by the Graph input methods.
+func NewNode(name string) Node {
+	return node(name)
+}
+
 type edge struct {
 	source string
 	target string
@@ -82,11 +107,13 @@ func (e *edge) String() string {
 func New(capacities ...uint) *Graph {
 	switch len(capacities) {
 	case 0:
-		return &Graph{nodes: make(map[string]Node), edges: make(map[edge]struct{})}
+		return &Graph{nodes: make(map[string]Node), edges: make(map[edge]struct{}), order: make(map[string]uint)}
 	case 1:
-		return &Graph{nodes: make(map[string]Node, capacities[0]), edges: make(map[edge]struct{})}
+		return &Graph{nodes: make(map[string]Node, capacities[0]), edges: make(map[edge]struct{}),
+			order: make(map[string]uint, capacities[0])}
 	case 2:
-		return &Graph{nodes: make(map[string]Node, capacities[0]), edges: make(map[edge]struct{}, capacities[1])}
+		return &Graph{nodes: make(map[string]Node, capacities[0]), edges: make(map[edge]struct{}, capacities[1]),
+			order: make(map[string]uint, capacities[0])}
 	default:
 		panic("More than 2 capacity parameters for graph.New")
 	}
@@ -97,7 +124,7 @@ func New(capacities ...uint) *Graph {
 // This operation takes constant time, O(1) (but proportional to the number of targetsNames).
 func (g *Graph) AddNode(node Node, targetNames ...string) {
 	nodeName := node.String()
-	g.nodes[nodeName] = node
+	g.putNode(nodeName, node)
 	for _, targetName := range targetNames {
 		if _, ok := g.nodes[targetName]; !ok {
 			panic(errors.New("AddNode: target node with name " + targetName + " not present in Graph"))
@@ -111,7 +138,7 @@ func (g *Graph) AddNode(node Node, targetNames ...string) {
 // This operation takes constant time, O(1) (but proportional to the number of new nodes).
 func (g *Graph) AddNodes(nodes ...Node) {
 	for _, node := range nodes {
-		g.nodes[node.String()] = node
+		g.putNode(node.String(), node)
 	}
 }
 
@@ -122,14 +149,16 @@ func (g *Graph) GetNode(name string) Node {
 	return g.nodes[name]
 }
 
-// GetNodes returns all Node objects saved in the Graph as a slice. If it is empty, an empty slice is returned.
+// GetNodes returns all Node objects saved in the Graph as a slice in declaration order. If it is empty, an empty slice
+// is returned.
 //
-// This operation takes time proportional to the number of nodes in g, O(n).
+// This operation takes time proportional to the number of nodes in g times its logarithm, O(n*log(n)).
 func (g *Graph) GetNodes() []Node {
 	nodes := make([]Node, 0, len(g.nodes))
 	for _, node := range g.nodes {
 		nodes = append(nodes, node)
 	}
+	g.sortNodes(nodes)
 	return nodes
 }
 
@@ -142,9 +171,15 @@ func (g *Graph) RemoveNode(name string) bool {
 		return false
 	}
 	delete(g.nodes, name)
+	delete(g.order, name)
+	delete(g.nodeAttrs, name)
+	delete(g.edges, edge{source: name, target: name})
+	delete(g.edgeAttrs, edge{source: name, target: name})
 	for node := range g.nodes {
-		delete(g.edges, edge{source: name, target: node})
-		delete(g.edges, edge{source: node, target: name})
+		for _, e := range [...]edge{{source: name, target: node}, {source: node, target: name}} {
+			delete(g.edges, e)
+			delete(g.edgeAttrs, e)
+		}
 	}
 	return true
 }
@@ -169,10 +204,10 @@ func (g *Graph) AddEdgeAndNodes(source, target Node) {
 	sourceName, targetName := source.String(), target.String()
 	// add the nodes if they aren't already in place
 	if _, ok := g.nodes[sourceName]; !ok {
-		g.nodes[sourceName] = source
+		g.putNode(sourceName, source)
 	}
 	if _, ok := g.nodes[targetName]; !ok {
-		g.nodes[targetName] = target
+		g.putNode(targetName, target)
 	}
 	g.edges[edge{source: sourceName, target: targetName}] = struct{}{}
 }
@@ -193,10 +228,59 @@ func (g *Graph) RemoveEdge(source, target string) bool {
 	e := edge{source: source, target: target}
 	_, ok := g.edges[e]
 	delete(g.edges, e)
+	delete(g.edgeAttrs, e)
 	return ok
 }
 
-// GetDependencies returns a slice containing all dependencies of the Node with the given string.
+// SetNodeAttribute sets the attribute with the given key of the Node with the given name to value.
+//
+// This operation takes constant time, O(1).
+func (g *Graph) SetNodeAttribute(name, key, value string) {
+	if _, ok := g.nodes[name]; !ok {
+		panic("SetNodeAttribute: Node " + name + " not present in Graph!")
+	}
+	if g.nodeAttrs == nil {
+		g.nodeAttrs = make(map[string]map[string]string)
+	}
+	if g.nodeAttrs[name] == nil {
+		g.nodeAttrs[name] = make(map[string]string)
+	}
+	g.nodeAttrs[name][key] = value
+}
+
+// NodeAttributes returns a copy of the attributes of the Node with the given name, or nil if it doesn't have any.
+//
+// This operation takes time proportional to the number of attributes of the Node.
+func (g *Graph) NodeAttributes(name string) map[string]string {
+	return copyAttributes(g.nodeAttrs[name])
+}
+
+// SetEdgeAttribute sets the attribute with the given key of the edge from the source Node to the target Node to value.
+//
+// This operation takes constant time, O(1).
+func (g *Graph) SetEdgeAttribute(source, target, key, value string) {
+	e := edge{source: source, target: target}
+	if _, ok := g.edges[e]; !ok {
+		panic("SetEdgeAttribute: edge " + e.String() + " not present in Graph!")
+	}
+	if g.edgeAttrs == nil {
+		g.edgeAttrs = make(map[edge]map[string]string)
+	}
+	if g.edgeAttrs[e] == nil {
+		g.edgeAttrs[e] = make(map[string]string)
+	}
+	g.edgeAttrs[e][key] = value
+}
+
+// EdgeAttributes returns a copy of the attributes of the edge from the source Node to the target Node, or nil if it
+// doesn't have any.
+//
+// This operation takes time proportional to the number of attributes of the edge.
+func (g *Graph) EdgeAttributes(source, target string) map[string]string {
+	return copyAttributes(g.edgeAttrs[edge{source: source, target: target}])
+}
+
+// GetDependencies returns a slice containing all dependencies of the Node with the given string in declaration order.
 // The Graph contains an edge from the Node to each item in the returned dependencies.
 //
 // This operation takes time proportional to the number of nodes in g, O(n).
@@ -207,10 +291,11 @@ func (g *Graph) GetDependencies(node string) []Node {
 			deps = append(deps, current)
 		}
 	}
+	g.sortNodes(deps)
 	return deps
 }
 
-// GetDependants returns a slice containing all dependants of the Node with the given string.
+// GetDependants returns a slice containing all dependants of the Node with the given string in declaration order.
 // The Graph contains an edge from each item in dependants to the Node.
 //
 // This operation takes time proportional to the number of nodes in g, O(n).
@@ -221,6 +306,7 @@ func (g *Graph) GetDependants(node string) []Node {
 			deps = append(deps, current)
 		}
 	}
+	g.sortNodes(deps)
 	return deps
 }
 
@@ -229,15 +315,24 @@ func (g *Graph) GetDependants(node string) []Node {
 // This operation takes time proportional to the sum of the number of nodes and the number of edges in g, O(n+e).
 func (g *Graph) Copy() Interface {
 	result := &Graph{
-		nodes: make(map[string]Node, len(g.nodes)),
-		edges: make(map[edge]struct{}, len(g.edges)),
+		nodes:     make(map[string]Node, len(g.nodes)),
+		edges:     make(map[edge]struct{}, len(g.edges)),
+		order:     make(map[string]uint, len(g.order)),
+		nextOrder: g.nextOrder,
 	}
 	for k, v := range g.nodes {
 		result.nodes[k] = v
+		result.order[k] = g.order[k]
 	}
 	for e := range g.edges {
 		result.edges[e] = struct{}{}
 	}
+	for name, attrs := range g.nodeAttrs {
+		result.setNodeAttributes(name, attrs)
+	}
+	for e, attrs := range g.edgeAttrs {
+		result.setEdgeAttributes(e, attrs)
+	}
 	return result
 }
 
@@ -257,8 +352,10 @@ func (g *Graph) GetDependencyGraph(nodename string) *Graph {
 		}
 	}
 	result := &Graph{
-		nodes: map[string]Node{nodename: start},
-		edges: map[edge]struct{}{},
+		nodes:     map[string]Node{nodename: start},
+		edges:     map[edge]struct{}{},
+		order:     map[string]uint{nodename: g.order[nodename]},
+		nextOrder: g.nextOrder,
 	}
 	// walk through the graph and add each node that we can reach from our start node
 	for i := 0; i < len(edges); i++ {
@@ -270,6 +367,7 @@ func (g *Graph) GetDependencyGraph(nodename string) *Graph {
 		}
 		// target has not been added yet, add it and its dependencies
 		result.nodes[current.target] = g.nodes[current.target]
+		result.order[current.target] = g.order[current.target]
 		// we modify the iterating slice here, but that is fine because it is only appending
 		for targetNode := range g.nodes {
 			e := edge{source: current.target, target: targetNode}
@@ -278,87 +376,307 @@ func (g *Graph) GetDependencyGraph(nodename string) *Graph {
 			}
 		}
 	}
+	for name := range result.nodes {
+		result.setNodeAttributes(name, g.nodeAttrs[name])
+	}
+	for e := range result.edges {
+		result.setEdgeAttributes(e, g.edgeAttrs[e])
+	}
 	return result
 }
 
-// FromScanner reads data from the given scanner, building up the dependency tree.
+// Order defines the order in which the nodes of a Graph are declared by graph.Sorted.
+type Order int
+
+const (
+	// DeclarationOrder keeps the order in which the nodes were declared in the input.
+	DeclarationOrder Order = iota
+	// NameOrder sorts the nodes by their name.
+	NameOrder
+	// TopologicalOrder sorts the nodes so that each node comes after its dependencies, the order in which they would be
+	// built. The nodes of a cycle are kept in declaration order.
+	TopologicalOrder
+)
+
+// Sorted returns a copy of graph including its attributes, whose nodes are declared in the given order.
+// As all methods of Graph return nodes in declaration order, this determines the order of all output functions.
+//
+// This operation takes time proportional to the product of the number of nodes and the number of edges in graph, O(n*e).
+func Sorted(graph Interface, order Order) *Graph {
+	nodes := graph.GetNodes()
+	switch order {
+	case NameOrder:
+		sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].String() < nodes[j].String() })
+	case TopologicalOrder:
+		nodes = nodes[:0]
+		for _, component := range StronglyConnectedComponents(graph) {
+			nodes = append(nodes, component...)
+		}
+	}
+	result := New(uint(len(nodes)))
+	result.AddNodes(nodes...)
+	attributed, _ := graph.(Attributed)
+	for _, n := range nodes {
+		name := n.String()
+		if attributed != nil {
+			result.setNodeAttributes(name, attributed.NodeAttributes(name))
+		}
+		for _, dep := range graph.GetDependencies(name) {
+			result.AddEdge(name, dep.String())
+			if attributed != nil {
+				result.setEdgeAttributes(edge{source: name, target: dep.String()}, attributed.EdgeAttributes(name, dep.String()))
+			}
+		}
+	}
+	return result
+}
+
+// FromScanner reads data from the given scanner, building up the dependency tree. The recipe lines following a
+// dependency line of a syntax with a RecipePrefix are stored as the "recipe" attribute of its sources, joined by
+// newlines. Like in make, a later recipe for the same node replaces the earlier one. For these syntaxes, the edges to
+// the normal prerequisites also get the attribute "position", see PrerequisiteOrder.
 func (g *Graph) FromScanner(scanner *bufio.Scanner, syntaxes ...*syntax.Syntax) (*Graph, error) {
 	if len(syntaxes) == 0 {
 		panic("FromScanner: At least one syntax required!")
 	}
 	scanner.Split(scanLineWithEscape)
 	activeSyntaxes := make(map[*syntax.Syntax]struct{}, len(syntaxes))
-	addEdge := func(s string, t string) { g.AddEdgeAndNodes(node(s), node(t)) }
+	// sources are the sources of the current line, rule the sources of the last dependency line with recipes
+	var sources []string
+	var rule recipeRule
+	lineNumber := 0
+	var recipes bool
+	addEdge := func(s string, t string, index int, orderOnly bool) {
+		g.addPrerequisite(s, t, recipes, lineNumber, index, orderOnly)
+		sources = appendSource(sources, s)
+	}
+	addNode := func(s string) {
+		g.AddNodes(node(s))
+		sources = appendSource(sources, s)
+	}
 	for scanner.Scan() {
 		if scanner.Err() != nil {
 			return g, scanner.Err()
 		}
 		line := scanner.Text()
+		lineNumber++
+		if rule.addRecipeLine(line) {
+			continue
+		}
+		rule.setRecipe(g.SetNodeAttribute)
+		sources = nil
 		for _, syntax := range syntaxes {
-			if strings.Contains(line, syntax.GraphPrefix) {
+			if syntax.Index(line, syntax.GraphPrefix) >= 0 {
 				activeSyntaxes[syntax] = struct{}{}
 			} else if _, active := activeSyntaxes[syntax]; !active {
 				continue
 			}
-			if syntax.GraphSuffix != "" && strings.Contains(line, syntax.GraphSuffix) {
+			if syntax.GraphSuffix != "" && syntax.Index(line, syntax.GraphSuffix) >= 0 {
 				delete(activeSyntaxes, syntax)
 			}
-			prefIndex := strings.Index(line, syntax.EdgePrefix)
-			infixIndex := strings.Index(line, syntax.EdgeInfix)
-			suffixIndex := strings.LastIndex(line, syntax.EdgeSuffix)
+			prefIndex := syntax.Index(line, syntax.EdgePrefix)
+			infixIndex := syntax.Index(line, syntax.EdgeInfix)
+			suffixIndex := syntax.LastIndex(line, syntax.EdgeSuffix)
 			if prefIndex >= 0 && infixIndex >= 0 && suffixIndex >= 0 {
-				scanDependencies(line[prefIndex+len(syntax.EdgePrefix):suffixIndex], syntax, addEdge)
+				recipes = syntax.RecipePrefix != ""
+				scanDependencies(line[prefIndex+len(syntax.EdgePrefix):suffixIndex], syntax, addEdge, addNode)
+				rule = recipeRule{syntax: syntax, sources: sources}
 				break
+			} else if prefIndex >= 0 && suffixIndex >= prefIndex+len(syntax.EdgePrefix) {
+				// a line declaring a single quoted node without any edges
+				if name := syntax.Trim(line[prefIndex+len(syntax.EdgePrefix) : suffixIndex]); syntax.Quoted(name) {
+					addNode(syntax.Unquote(name))
+					break
+				}
 			}
 		}
 	}
+	rule.setRecipe(g.SetNodeAttribute)
 	return g, nil
 }
 
-// String returns a simple string representation consisting of all edges.
+// MarkPhony replaces the special Makefile target .PHONY in g by setting the attribute "phony" to "true" on each of its
+// dependencies, so that it doesn't show up as a node depending on all phony targets.
+func (g *Graph) MarkPhony() {
+	for _, target := range g.GetDependencies(".PHONY") {
+		g.SetNodeAttribute(target.String(), "phony", "true")
+	}
+	g.RemoveNode(".PHONY")
+}
+
+// String returns a simple string representation consisting of all edges, ordered by the declaration order of their
+// source and target nodes.
 //
-// This operation takes time proportional to the number of edges in g, O(e).
+// This operation takes time proportional to the number of edges in g times its logarithm, O(e*log(e)).
 func (g *Graph) String() string {
 	if len(g.nodes) == 0 {
 		return "{empty graph}"
 	}
+	edges := make([]edge, 0, len(g.edges))
+	for e := range g.edges {
+		edges = append(edges, e)
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if g.order[edges[i].source] != g.order[edges[j].source] {
+			return g.order[edges[i].source] < g.order[edges[j].source]
+		}
+		return g.order[edges[i].target] < g.order[edges[j].target]
+	})
 	var buffer bytes.Buffer
-	for edge := range g.edges {
+	for _, edge := range edges {
 		buffer.WriteString(edge.String())
 		buffer.WriteString("; ")
 	}
 	return buffer.String()
 }
 
-// scanDependencies adds the given dependency line with the given syntax as edges by calling the given addEdge function.
-func scanDependencies(line string, syntax *syntax.Syntax, addEdge func(string, string)) {
-	infixIndex := strings.Index(line, syntax.EdgeInfix)
-	sources := []string{line[:infixIndex]}
-	if syntax.SourceDelimiter != "" {
-		sources = strings.Split(line[:infixIndex], syntax.SourceDelimiter)
+// putNode stores the node under the given name, declaring it if it is not present in g yet.
+func (g *Graph) putNode(name string, node Node) {
+	if _, ok := g.nodes[name]; !ok {
+		g.order[name] = g.nextOrder
+		g.nextOrder++
+	}
+	g.nodes[name] = node
+}
+
+// sortNodes sorts the given nodes of g by their declaration order.
+func (g *Graph) sortNodes(nodes []Node) {
+	sort.Slice(nodes, func(i, j int) bool { return g.order[nodes[i].String()] < g.order[nodes[j].String()] })
+}
+
+// setNodeAttributes sets a copy of the given attributes as the attributes of the Node with the given name.
+func (g *Graph) setNodeAttributes(name string, attrs map[string]string) {
+	if len(attrs) == 0 {
+		return
+	}
+	if g.nodeAttrs == nil {
+		g.nodeAttrs = make(map[string]map[string]string)
+	}
+	g.nodeAttrs[name] = copyAttributes(attrs)
+}
+
+// setEdgeAttributes sets a copy of the given attributes as the attributes of the edge e.
+func (g *Graph) setEdgeAttributes(e edge, attrs map[string]string) {
+	if len(attrs) == 0 {
+		return
+	}
+	if g.edgeAttrs == nil {
+		g.edgeAttrs = make(map[edge]map[string]string)
+	}
+	g.edgeAttrs[e] = copyAttributes(attrs)
+}
+
+// copyAttributes returns a copy of the given attribute map, or nil if it is empty.
+func copyAttributes(attrs map[string]string) map[string]string {
+	if len(attrs) == 0 {
+		return nil
+	}
+	result := make(map[string]string, len(attrs))
+	for k, v := range attrs {
+		result[k] = v
+	}
+	return result
+}
+
+// scanDependencies adds the given dependency line with the given syntax as edges by calling the given addEdge function
+// with the index of the target in the line. Targets after the OrderOnlyDelimiter of the syntax are added with orderOnly
+// set. Sources without any targets are added by calling addNode. Quoted and escaped names are unquoted according to the
+// syntax.
+func scanDependencies(line string, syntax *syntax.Syntax,
+	addEdge func(source, target string, index int, orderOnly bool), addNode func(string)) {
+	infixIndex := syntax.Index(line, syntax.EdgeInfix)
+	sources := syntax.Split(line[:infixIndex], syntax.SourceDelimiter)
+	targetLine, orderOnlyLine := line[infixIndex+len(syntax.EdgeInfix):], ""
+	if syntax.OrderOnlyDelimiter != "" {
+		if index := syntax.Index(targetLine, syntax.OrderOnlyDelimiter); index >= 0 {
+			targetLine, orderOnlyLine = targetLine[:index], targetLine[index+len(syntax.OrderOnlyDelimiter):]
+		}
 	}
-	targets := strings.Split(line[infixIndex+len(syntax.EdgeInfix):], syntax.TargetDelimiter)
+	targets := syntax.Split(targetLine, syntax.TargetDelimiter)
+	firstOrderOnly := len(targets)
+	targets = append(targets, syntax.Split(orderOnlyLine, syntax.TargetDelimiter)...)
 	for _, source := range sources {
 		if syntax.StripWhitespace {
-			source = strings.TrimSpace(source)
+			source = syntax.Trim(source)
 		}
 		if source != "" {
-			for _, target := range targets {
+			added := 0
+			for index, target := range targets {
 				if syntax.StripWhitespace {
-					target = strings.TrimSpace(target)
+					target = syntax.Trim(target)
 				}
 				if target != "" {
-					addEdge(source, target)
+					addEdge(syntax.Unquote(source), syntax.Unquote(target), added, index >= firstOrderOnly)
+					added++
 				}
 			}
+			if added == 0 {
+				addNode(syntax.Unquote(source))
+			}
 		}
 	}
 }
 
-// scanLineWithEscape is a drop-in replacement for bufio.ScanLines, appending the next line if the last byte is a backslash '\'
+// addPrerequisite adds the edge from source to target read by FromScanner from the given line. Order-only edges get
+// the attribute "order-only", and if recipes is set, the other edges get the attribute "position" with the line number
+// and the index of the target in the line, keeping the earliest position if the edge is declared by several lines.
+func (g *Graph) addPrerequisite(source, target string, recipes bool, line, index int, orderOnly bool) {
+	g.AddEdgeAndNodes(node(source), node(target))
+	if orderOnly {
+		g.SetEdgeAttribute(source, target, "order-only", "true")
+	} else if recipes {
+		previous, ok := parsePosition(g.EdgeAttributes(source, target)["position"])
+		if !ok || line < previous[0] || line == previous[0] && index < previous[1] {
+			g.SetEdgeAttribute(source, target, "position", fmt.Sprintf("%d:%d", line, index))
+		}
+	}
+}
+
+// recipeRule collects the recipe lines following a dependency line.
+type recipeRule struct {
+	// syntax is the syntax of the dependency line, nil if recipe lines aren't expected
+	syntax  *syntax.Syntax
+	sources []string
+	recipe  []string
+}
+
+// addRecipeLine adds line to the recipe of r and returns true if it is a recipe line. Empty lines are skipped.
+func (r *recipeRule) addRecipeLine(line string) bool {
+	if r.syntax == nil || r.syntax.RecipePrefix == "" {
+		return false
+	}
+	if strings.HasPrefix(line, r.syntax.RecipePrefix) {
+		r.recipe = append(r.recipe, strings.TrimSpace(strings.TrimPrefix(line, r.syntax.RecipePrefix)))
+		return true
+	}
+	return strings.TrimSpace(line) == ""
+}
+
+// setRecipe sets the collected recipe as the "recipe" attribute of the sources by calling setAttribute, if there is
+// one, and resets r.
+func (r *recipeRule) setRecipe(setAttribute func(name, key, value string)) {
+	if len(r.recipe) > 0 {
+		for _, source := range r.sources {
+			setAttribute(source, "recipe", strings.Join(r.recipe, "\n"))
+		}
+	}
+	*r = recipeRule{}
+}
+
+// appendSource appends source to sources unless it is already the last one, as scanDependencies adds all edges of a
+// source one after another.
+func appendSource(sources []string, source string) []string {
+	if len(sources) > 0 && sources[len(sources)-1] == source {
+		return sources
+	}
+	return append(sources, source)
+}
+
+// scanLineWithEscape is a drop-in replacement for bufio.ScanLines, appending the next line if the line ends with a
+// backslash '\' that is not escaped itself.
 func scanLineWithEscape(data []byte, atEOF bool) (advance int, token []byte, err error) {
 	advance, token, err = bufio.ScanLines(data, atEOF)
-	for err == nil && len(token) > 0 && token[len(token)-1] == '\\' {
+	for err == nil && endsWithEscape(token) {
 		// omit the trailing backslash
 		token = token[:len(token)-1]
 		nextData := data[advance:]
@@ -370,3 +688,12 @@ func scanLineWithEscape(data []byte, atEOF bool) (advance int, token []byte, err
 	}
 	return
 }
+
+// endsWithEscape returns true if line ends with an odd number of backslashes, so the last one escapes the line break.
+func endsWithEscape(line []byte) bool {
+	backslashes := 0
+	for i := len(line) - 1; i >= 0 && line[i] == '\\'; i-- {
+		backslashes++
+	}
+	return backslashes%2 == 1
+}
@@ -0,0 +1,238 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Contains graph algorithms that work with every implementation of graph.Interface.
+package graph
+
+// StronglyConnectedComponents returns the strongly connected components of graph, i.e. the maximal sets of nodes that
+// can all reach each other. Every node is part of exactly one component. The components are returned in reverse
+// topological order, so each component only depends on components before it, the nodes of a component in the order of
+// GetNodes.
+//
+// This uses Tarjan's algorithm and takes time proportional to the sum of the number of nodes and the number of edges
+// in graph plus the cost of a GetDependencies call for each node.
+func StronglyConnectedComponents(graph Interface) [][]Node {
+	nodes := graph.GetNodes()
+	position := make(map[string]int, len(nodes))
+	for i, n := range nodes {
+		position[n.String()] = i
+	}
+	index := make(map[string]int, len(nodes))
+	lowlink := make(map[string]int, len(nodes))
+	onStack := make(map[string]bool, len(nodes))
+	var stack []Node
+	var components [][]Node
+	var connect func(n Node)
+	connect = func(n Node) {
+		name := n.String()
+		index[name] = len(index)
+		lowlink[name] = index[name]
+		stack = append(stack, n)
+		onStack[name] = true
+		for _, dep := range graph.GetDependencies(name) {
+			depName := dep.String()
+			if _, visited := index[depName]; !visited {
+				connect(dep)
+				if lowlink[depName] < lowlink[name] {
+					lowlink[name] = lowlink[depName]
+				}
+			} else if onStack[depName] && index[depName] < lowlink[name] {
+				lowlink[name] = index[depName]
+			}
+		}
+		if lowlink[name] == index[name] {
+			// n is the root of a component, pop it from the stack
+			var component []Node
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top.String()] = false
+				component = append(component, top)
+				if top.String() == name {
+					break
+				}
+			}
+			// restore the node order of the graph
+			for i := 1; i < len(component); i++ {
+				for j := i; j > 0 && position[component[j].String()] < position[component[j-1].String()]; j-- {
+					component[j], component[j-1] = component[j-1], component[j]
+				}
+			}
+			components = append(components, component)
+		}
+	}
+	for _, n := range nodes {
+		if _, visited := index[n.String()]; !visited {
+			connect(n)
+		}
+	}
+	return components
+}
+
+// Cycles returns the strongly connected components of graph that contain a cycle, i.e. the components with more than
+// one node and single nodes with an edge to themselves.
+func Cycles(graph Interface) [][]Node {
+	var cycles [][]Node
+	for _, component := range StronglyConnectedComponents(graph) {
+		if len(component) > 1 || graph.HasEdge(component[0].String(), component[0].String()) {
+			cycles = append(cycles, component)
+		}
+	}
+	return cycles
+}
+
+// IsPhony returns true if the node with the given name is a phony target, i.e. the graph contains an edge from the
+// special Makefile target .PHONY to it or it has the attribute "phony" set to "true".
+func IsPhony(graph Interface, name string) bool {
+	if graph.HasEdge(".PHONY", name) {
+		return true
+	}
+	if attributed, ok := graph.(Attributed); ok {
+		return attributed.NodeAttributes(name)["phony"] == "true"
+	}
+	return false
+}
+
+// DependencyClosure returns the nodes with the given names and all nodes they depend on directly or indirectly, in the
+// order of GetNodes. Names that aren't in graph are ignored.
+//
+// This operation takes time proportional to the sum of the number of nodes and the number of edges in graph plus the
+// cost of a GetDependencies call for each returned node.
+func DependencyClosure(graph Interface, names ...string) []Node {
+	return filterNodes(graph, closure(graph.GetDependencies, names...))
+}
+
+// DependantClosure returns the nodes with the given names and all nodes depending on them directly or indirectly, in
+// the order of GetNodes. Names that aren't in graph are ignored.
+//
+// This operation takes time proportional to the sum of the number of nodes and the number of edges in graph plus the
+// cost of a GetDependants call for each returned node.
+func DependantClosure(graph Interface, names ...string) []Node {
+	return filterNodes(graph, closure(graph.GetDependants, names...))
+}
+
+// Affected returns the nodes that a change of the nodes with the given names affects, i.e. the changed nodes themselves
+// and all nodes depending on them directly or indirectly, for which keep returns true, in the order of GetNodes. Names
+// that aren't in graph are ignored. If keep is nil, all affected nodes are returned.
+//
+// This operation takes time proportional to the sum of the number of nodes and the number of edges in graph plus the
+// cost of a GetDependants call for each affected node.
+func Affected(graph Interface, changed []string, keep func(name string) bool) []Node {
+	var result []Node
+	for _, n := range DependantClosure(graph, changed...) {
+		if keep == nil || keep(n.String()) {
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+// Subgraph returns a new Graph with the given nodes of graph and all edges between them, including their attributes.
+// The nodes are declared in the order of graph.
+func Subgraph(graph Interface, nodes []Node) *Graph {
+	set := make(map[string]struct{}, len(nodes))
+	for _, n := range nodes {
+		set[n.String()] = struct{}{}
+	}
+	result := New(uint(len(set)))
+	attributed, _ := graph.(Attributed)
+	nodes = filterNodes(graph, set)
+	result.AddNodes(nodes...)
+	for _, n := range nodes {
+		name := n.String()
+		if attributed != nil {
+			result.setNodeAttributes(name, attributed.NodeAttributes(name))
+		}
+		for _, dep := range graph.GetDependencies(name) {
+			if _, ok := set[dep.String()]; ok {
+				result.AddEdge(name, dep.String())
+				if attributed != nil {
+					result.setEdgeAttributes(edge{source: name, target: dep.String()},
+						attributed.EdgeAttributes(name, dep.String()))
+				}
+			}
+		}
+	}
+	return result
+}
+
+// ShortestPath returns the nodes of a shortest chain of dependencies leading from the node source to the node target,
+// including both, or nil if there is none. If source and target are the same, it returns a shortest cycle through
+// the node, starting and ending with it, or nil if it isn't part of a cycle.
+//
+// This uses a breadth-first search, which takes time proportional to the sum of the number of nodes and the number of
+// edges in graph plus the cost of a GetDependencies call for each visited node.
+func ShortestPath(graph Interface, source, target string) []Node {
+	if graph.GetNode(source) == nil || graph.GetNode(target) == nil {
+		return nil
+	}
+	// previous contains the node before each visited node on a shortest path from source
+	previous := map[string]Node{}
+	queue := []Node{graph.GetNode(source)}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, dep := range graph.GetDependencies(current.String()) {
+			if _, visited := previous[dep.String()]; visited {
+				continue
+			}
+			previous[dep.String()] = current
+			if dep.String() == target {
+				path := []Node{dep}
+				for n := current; ; n = previous[n.String()] {
+					path = append(path, n)
+					if n.String() == source && len(path) > 1 {
+						break
+					}
+				}
+				for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+					path[i], path[j] = path[j], path[i]
+				}
+				return path
+			}
+			queue = append(queue, dep)
+		}
+	}
+	return nil
+}
+
+// closure returns the set of names of the nodes with the given names in graph and all nodes reachable from them by
+// repeatedly calling next.
+func closure(next func(string) []Node, names ...string) map[string]struct{} {
+	result := map[string]struct{}{}
+	stack := append([]string(nil), names...)
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if _, ok := result[current]; ok {
+			continue
+		}
+		result[current] = struct{}{}
+		for _, n := range next(current) {
+			stack = append(stack, n.String())
+		}
+	}
+	return result
+}
+
+// adjacency returns the nodes returned by next for each node of graph, keyed by the name of the node, so they can be
+// looked up repeatedly without calling next again.
+func adjacency(graph Interface, next func(string) []Node) map[string][]Node {
+	result := make(map[string][]Node)
+	for _, n := range graph.GetNodes() {
+		result[n.String()] = next(n.String())
+	}
+	return result
+}
+
+// filterNodes returns the nodes of graph whose names are in set, in the order of GetNodes.
+func filterNodes(graph Interface, set map[string]struct{}) []Node {
+	var result []Node
+	for _, n := range graph.GetNodes() {
+		if _, ok := set[n.String()]; ok {
+			result = append(result, n)
+		}
+	}
+	return result
+}
@@ -0,0 +1,79 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Contains the tabular CSV output formats for spreadsheets and data analysis tools.
+package graph
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+// WriteCSV writes the edges of the given graph to writer as CSV with a header row and one "source,target" row per edge.
+// Returns the first error encountered while writing.
+func WriteCSV(graph Interface, writer io.Writer) error {
+	w := csv.NewWriter(writer)
+	w.Write([]string{"source", "target"})
+	for _, n := range graph.GetNodes() {
+		for _, dep := range graph.GetDependencies(n.String()) {
+			w.Write([]string{n.String(), dep.String()})
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// WriteMatrix writes the adjacency matrix of the given graph to writer as CSV. The header row and the first column
+// contain the node names in the order of GetNodes, the cell in the row of a node and the column of another one is 1 if
+// the first node depends on the second one and 0 otherwise. Use Sorted to order the matrix by name or topologically.
+// Returns the first error encountered while writing.
+//
+// This operation takes time proportional to the square of the number of nodes in graph, O(n^2).
+func WriteMatrix(graph Interface, writer io.Writer) error {
+	nodes := graph.GetNodes()
+	w := csv.NewWriter(writer)
+	row := make([]string, len(nodes)+1)
+	for i, n := range nodes {
+		row[i+1] = n.String()
+	}
+	w.Write(row)
+	for _, n := range nodes {
+		row[0] = n.String()
+		for i, target := range nodes {
+			row[i+1] = "0"
+			if graph.HasEdge(n.String(), target.String()) {
+				row[i+1] = "1"
+			}
+		}
+		w.Write(row)
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// WriteNodeTable writes a table with a row for each node of the given graph to writer as CSV. The columns contain the
+// name of the node, its number of dependants (in-degree) and dependencies (out-degree), and the number of nodes it
+// depends on directly or indirectly and that depend on it directly or indirectly.
+// Returns the first error encountered while writing.
+//
+// This operation calls GetDependencies and GetDependants once for each node of graph, and then takes time proportional
+// to the product of the number of nodes and the sum of the number of nodes and the number of edges in graph,
+// O(n*(n+e)).
+func WriteNodeTable(graph Interface, writer io.Writer) error {
+	dependencies, dependants := adjacency(graph, graph.GetDependencies), adjacency(graph, graph.GetDependants)
+	w := csv.NewWriter(writer)
+	w.Write([]string{"node", "in_degree", "out_degree", "transitive_dependencies", "transitive_dependants"})
+	for _, n := range graph.GetNodes() {
+		name := n.String()
+		w.Write([]string{name,
+			strconv.Itoa(len(dependants[name])),
+			strconv.Itoa(len(dependencies[name])),
+			strconv.Itoa(len(closure(func(name string) []Node { return dependencies[name] }, name)) - 1),
+			strconv.Itoa(len(closure(func(name string) []Node { return dependants[name] }, name)) - 1),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,215 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Contains the configurable Graphviz dot writer.
+package graph
+
+import (
+	"github.com/SimplicityApks/depgrapher/syntax"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// DotOptions configures the output of WriteDotOptions. The zero value writes the same output as WriteDot.
+type DotOptions struct {
+	// RankDir sets the direction of the graph layout, one of "TB", "LR", "BT" and "RL"
+	RankDir string
+	// GraphAttributes are written as attributes of the whole graph, e.g. "splines" = "ortho"
+	GraphAttributes map[string]string
+	// Cluster returns the cluster of a node, nodes of the same cluster are grouped in a subgraph cluster_<name>.
+	// Nodes in the cluster "" aren't grouped. See ClusterByDirectory and ClusterByPrefix.
+	Cluster func(name string) string
+	// Rules set the attributes of the nodes they match, later rules override earlier ones and all rules override the
+	// attributes of the node itself
+	Rules []DotRule
+	// Highlight is the name of a node that is highlighted together with its dependencies, their dependencies and so
+	// on and the edges between them
+	Highlight string
+	// HighlightAttributes are the attributes of the highlighted nodes and edges, defaults to a thick red border
+	HighlightAttributes map[string]string
+}
+
+// DotRule sets dot attributes like "shape" or "color" on all nodes whose name matches Pattern, a glob pattern as
+// described in MatchGlob. An empty Pattern matches all nodes, if Phony is set only phony targets (see IsPhony) match.
+type DotRule struct {
+	Pattern    string
+	Phony      bool
+	Attributes map[string]string
+}
+
+// Matches returns true if the node with the given name matches the rule.
+func (rule *DotRule) Matches(graph Interface, name string) bool {
+	if rule.Phony && !IsPhony(graph, name) {
+		return false
+	}
+	return rule.Pattern == "" || MatchGlob(rule.Pattern, name)
+}
+
+// ClusterByDirectory puts the nodes into clusters by the directory of their path, nodes in the current directory
+// aren't clustered.
+func ClusterByDirectory(name string) string {
+	if dir := path.Dir(name); dir != "." {
+		return dir
+	}
+	return ""
+}
+
+// ClusterByPrefix returns a function for DotOptions.Cluster that puts the nodes into clusters by the first segments
+// of their slash-separated path. Nodes with a path of at most segments segments aren't clustered.
+func ClusterByPrefix(segments int) func(name string) string {
+	return func(name string) string {
+		parts := strings.Split(name, "/")
+		if len(parts) <= segments {
+			return ""
+		}
+		return strings.Join(parts[:segments], "/")
+	}
+}
+
+// WriteDotOptions writes the given graph to writer in the dot language like WriteDot, applying the given options.
+// All nodes are declared with their attributes, followed by the edges with theirs.
+// Returns the first error encountered while writing.
+func WriteDotOptions(graph Interface, writer io.Writer, opts DotOptions) error {
+	if opts.RankDir == "" && len(opts.GraphAttributes) == 0 && opts.Cluster == nil && len(opts.Rules) == 0 &&
+		opts.Highlight == "" {
+		return WriteDot(graph, writer)
+	}
+	highlighted := map[string]struct{}{}
+	if opts.Highlight != "" && graph.GetNode(opts.Highlight) != nil {
+		highlighted = closure(graph.GetDependencies, opts.Highlight)
+	}
+	highlight := opts.HighlightAttributes
+	if highlight == nil {
+		highlight = map[string]string{"color": "red", "penwidth": "2"}
+	}
+	attributed, _ := graph.(Attributed)
+
+	w := &errWriter{w: writer}
+	w.printf("digraph {\n")
+	if opts.RankDir != "" {
+		w.printf("  rankdir=%s;\n", syntax.Dot.Quote(opts.RankDir))
+	}
+	for _, key := range sortedKeys(opts.GraphAttributes) {
+		w.printf("  %s=%s;\n", dotID(key), syntax.Dot.Quote(opts.GraphAttributes[key]))
+	}
+	// group the nodes by cluster, keeping the order of their first node
+	nodes := graph.GetNodes()
+	var clusters []string
+	members := map[string][]string{}
+	for _, n := range nodes {
+		cluster := ""
+		if opts.Cluster != nil {
+			cluster = opts.Cluster(n.String())
+		}
+		if _, ok := members[cluster]; !ok {
+			clusters = append(clusters, cluster)
+		}
+		members[cluster] = append(members[cluster], n.String())
+	}
+	for _, cluster := range clusters {
+		indent := "  "
+		if cluster != "" {
+			w.printf("  subgraph %s {\n    label=%s;\n", syntax.Dot.Quote("cluster_"+cluster), syntax.Dot.Quote(cluster))
+			indent = "    "
+		}
+		for _, name := range members[cluster] {
+			attrs := map[string]string{}
+			if attributed != nil {
+				copyDotAttributes(attrs, attributed.NodeAttributes(name))
+			}
+			for i := range opts.Rules {
+				if opts.Rules[i].Matches(graph, name) {
+					for key, value := range opts.Rules[i].Attributes {
+						attrs[key] = value
+					}
+				}
+			}
+			if _, ok := highlighted[name]; ok {
+				for key, value := range highlight {
+					attrs[key] = value
+				}
+			}
+			w.printf("%s%s%s;\n", indent, syntax.Dot.Quote(name), dotAttributeList(attrs))
+		}
+		if cluster != "" {
+			w.printf("  }\n")
+		}
+	}
+	for _, n := range nodes {
+		source := n.String()
+		for _, dep := range graph.GetDependencies(source) {
+			target := dep.String()
+			attrs := map[string]string{}
+			if attributed != nil {
+				copyDotAttributes(attrs, attributed.EdgeAttributes(source, target))
+			}
+			_, sourceHighlighted := highlighted[source]
+			_, targetHighlighted := highlighted[target]
+			if sourceHighlighted && targetHighlighted {
+				for key, value := range highlight {
+					attrs[key] = value
+				}
+			}
+			w.printf("  %s -> %s%s;\n", syntax.Dot.Quote(source), syntax.Dot.Quote(target), dotAttributeList(attrs))
+		}
+	}
+	w.printf("}\n")
+	return w.err
+}
+
+// copyDotAttributes copies the attributes of a node or an edge of the graph to the dot attributes dst. The internal
+// attributes stored by FromScanner and MarkPhony aren't dot attributes: "recipe", "position" and "phony" are left out,
+// phony targets can be styled with DotRule.Phony instead, and order-only edges are dashed unless they have their own
+// style.
+func copyDotAttributes(dst, src map[string]string) {
+	for key, value := range src {
+		switch key {
+		case "recipe", "position", "phony":
+		case "order-only":
+			if _, ok := src["style"]; !ok && value == "true" {
+				dst["style"] = "dashed"
+			}
+		default:
+			dst[key] = value
+		}
+	}
+}
+
+// dotAttributeList returns attrs as a dot attribute list sorted by key, starting with a space, or "" if attrs is
+// empty.
+func dotAttributeList(attrs map[string]string) string {
+	if len(attrs) == 0 {
+		return ""
+	}
+	var list []string
+	for _, key := range sortedKeys(attrs) {
+		list = append(list, dotID(key)+"="+syntax.Dot.Quote(attrs[key]))
+	}
+	return " [" + strings.Join(list, ", ") + "]"
+}
+
+// dotID returns s unchanged if it is a valid unquoted dot identifier, or quoted otherwise.
+func dotID(s string) string {
+	for i, r := range s {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || i > 0 && r >= '0' && r <= '9') {
+			return syntax.Dot.Quote(s)
+		}
+	}
+	if s == "" {
+		return syntax.Dot.Quote(s)
+	}
+	return s
+}
+
+// sortedKeys returns the keys of m in ascending order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
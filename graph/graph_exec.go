@@ -0,0 +1,357 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Contains a parallel executor running the commands of the nodes in dependency order, like make.
+package graph
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ExecOptions control how Execute runs the commands of the nodes.
+type ExecOptions struct {
+	// Jobs is the maximum number of nodes whose commands run at the same time, defaults to the number of CPUs
+	Jobs int
+	// KeepGoing keeps running the nodes that don't depend on a failed node, like make -k
+	KeepGoing bool
+	// DryRun writes the schedule to Output instead of running any commands
+	DryRun bool
+	// Timeout is the maximum time the commands of a single node may take, 0 for no limit
+	Timeout time.Duration
+	// Commands returns the commands of the node with the given name, defaults to RecipeCommands
+	Commands func(graph Interface, name string) []string
+	// Run runs a single command for the node with the given name and writes its output to output, defaults to
+	// RunShell
+	Run func(ctx context.Context, name, command string, output io.Writer) error
+	// Output receives the commands and their output, nothing is written if it is nil
+	Output io.Writer
+}
+
+// NodeError is the error of a node that failed in Execute.
+type NodeError struct {
+	Name string
+	Err  error
+}
+
+func (e *NodeError) Error() string {
+	return e.Name + ": " + e.Err.Error()
+}
+
+// ExecError is returned by Execute if the commands of any node failed.
+type ExecError struct {
+	// Failed contains the errors of the failed nodes in the order of GetNodes
+	Failed []*NodeError
+	// Skipped contains the nodes that weren't run because a dependency failed, in the order of GetNodes
+	Skipped []string
+}
+
+func (e *ExecError) Error() string {
+	names := make([]string, len(e.Failed))
+	for i, failed := range e.Failed {
+		names[i] = failed.Name
+	}
+	return fmt.Sprintf("%d failed, %d skipped: %s", len(e.Failed), len(e.Skipped), strings.Join(names, ", "))
+}
+
+// RecipeCommands returns the lines of the "recipe" attribute of the node with the given name, as stored by
+// FromScanner, with the automatic variables expanded by ExpandCommand. It returns nil for nodes without a recipe.
+func RecipeCommands(graph Interface, name string) []string {
+	attributed, ok := graph.(Attributed)
+	if !ok || attributed.NodeAttributes(name)["recipe"] == "" {
+		return nil
+	}
+	lines := strings.Split(attributed.NodeAttributes(name)["recipe"], "\n")
+	for i, line := range lines {
+		lines[i] = ExpandCommand(graph, name, line)
+	}
+	return lines
+}
+
+// TemplateCommands returns a function for ExecOptions.Commands running the given template for every node except the
+// phony ones, with the automatic variables expanded by ExpandCommand.
+func TemplateCommands(template string) func(graph Interface, name string) []string {
+	return func(graph Interface, name string) []string {
+		if IsPhony(graph, name) {
+			return nil
+		}
+		return []string{ExpandCommand(graph, name, template)}
+	}
+}
+
+// ExpandCommand expands the automatic variables of make in command for the node with the given name: "$@" is the name
+// of the node, "$<" its first prerequisite, "$^" all its prerequisites separated by spaces and "$$" a single dollar
+// sign. The prerequisites are the dependencies in the order returned by PrerequisiteOrder. All other variables are
+// left to the shell.
+func ExpandCommand(graph Interface, name, command string) string {
+	prerequisites := PrerequisiteOrder(graph, name)
+	names := make([]string, len(prerequisites))
+	for i, dep := range prerequisites {
+		names[i] = dep.String()
+	}
+	first := ""
+	if len(names) > 0 {
+		first = names[0]
+	}
+	return strings.NewReplacer("$$", "$", "$@", name, "$<", first, "$^", strings.Join(names, " ")).Replace(command)
+}
+
+// PrerequisiteOrder returns the dependencies of the node with the given name in the order they were declared, like
+// make does, leaving out the order-only ones. The order is given by the "position" attributes of the edges, set by
+// FromScanner to the line number and the index of the dependency in the line, e.g. "3:1". Edges without a position
+// follow in the order of GetDependencies.
+func PrerequisiteOrder(graph Interface, name string) []Node {
+	attributed, _ := graph.(Attributed)
+	var result []Node
+	positions := make(map[string][2]int)
+	for _, dep := range graph.GetDependencies(name) {
+		var attrs map[string]string
+		if attributed != nil {
+			attrs = attributed.EdgeAttributes(name, dep.String())
+		}
+		if attrs["order-only"] == "true" {
+			continue
+		}
+		position, ok := parsePosition(attrs["position"])
+		if !ok {
+			position = [2]int{math.MaxInt, 0}
+		}
+		positions[dep.String()] = position
+		result = append(result, dep)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		a, b := positions[result[i].String()], positions[result[j].String()]
+		return a[0] < b[0] || a[0] == b[0] && a[1] < b[1]
+	})
+	return result
+}
+
+// parsePosition returns the line number and the index of a "position" attribute, or false if it isn't one.
+func parsePosition(position string) ([2]int, bool) {
+	var result [2]int
+	if _, err := fmt.Sscanf(position, "%d:%d", &result[0], &result[1]); err != nil {
+		return result, false
+	}
+	return result, true
+}
+
+// RunShell runs command with "sh -c", writing its standard and error output to output.
+func RunShell(ctx context.Context, name, command string, output io.Writer) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdout, cmd.Stderr = output, output
+	// don't wait for the output of processes started by a killed shell
+	cmd.WaitDelay = time.Second
+	return cmd.Run()
+}
+
+// Execute runs the commands of the given targets and all nodes they depend on, or of all nodes of graph if there are
+// no targets, with at most opts.Jobs nodes running at the same time. The commands of a node run one after another
+// once the commands of all its dependencies succeeded. Like in make, a command starting with '@' isn't written to
+// opts.Output and the failure of a command starting with '-' is ignored. The output of each node is written at once
+// when its commands finished, so the output of parallel nodes doesn't interleave.
+//
+// If a node fails, Execute waits for the running nodes and returns an *ExecError, or with opts.KeepGoing, first runs
+// all nodes that don't depend on a failed one. It returns an error without running any commands if the nodes contain
+// a dependency cycle or a target isn't in graph.
+func Execute(ctx context.Context, graph Interface, targets []string, opts ExecOptions) error {
+	if opts.Jobs <= 0 {
+		opts.Jobs = runtime.NumCPU()
+	}
+	if opts.Commands == nil {
+		opts.Commands = RecipeCommands
+	}
+	if opts.Run == nil {
+		opts.Run = RunShell
+	}
+	if opts.Output == nil {
+		opts.Output = io.Discard
+	}
+	nodes := graph.GetNodes()
+	if len(targets) > 0 {
+		for _, target := range targets {
+			if graph.GetNode(target) == nil {
+				return fmt.Errorf("target %q not found", target)
+			}
+		}
+		nodes = DependencyClosure(graph, targets...)
+	}
+	e := &executor{
+		graph:    Subgraph(graph, nodes),
+		opts:     opts,
+		commands: make(map[string][]string, len(nodes)),
+		pending:  make(map[string]int, len(nodes)),
+		failed:   map[string]error{},
+		done:     map[string]bool{},
+	}
+	if cycles := Cycles(e.graph); len(cycles) > 0 {
+		start := cycles[0][0].String()
+		path := ShortestPath(e.graph, start, start)
+		names := make([]string, len(path))
+		for i, n := range path {
+			names[i] = n.String()
+		}
+		return fmt.Errorf("dependency cycle: %s", strings.Join(names, " -> "))
+	}
+	for _, n := range nodes {
+		e.commands[n.String()] = opts.Commands(graph, n.String())
+	}
+	if opts.DryRun {
+		return e.writeSchedule()
+	}
+	return e.run(ctx)
+}
+
+// executor holds the state of Execute.
+type executor struct {
+	// graph contains the nodes to run
+	graph    *Graph
+	opts     ExecOptions
+	commands map[string][]string
+	// pending counts the dependencies of each node that haven't succeeded yet
+	pending map[string]int
+	// ready contains the nodes whose dependencies all succeeded, in the order they became ready
+	ready  []string
+	failed map[string]error
+	done   map[string]bool
+}
+
+// execResult is the result of running the commands of a node.
+type execResult struct {
+	name   string
+	output []byte
+	err    error
+}
+
+// run runs the nodes of e.graph with a pool of opts.Jobs workers.
+func (e *executor) run(ctx context.Context) error {
+	for _, n := range e.graph.GetNodes() {
+		if e.pending[n.String()] = len(e.graph.GetDependencies(n.String())); e.pending[n.String()] == 0 {
+			e.ready = append(e.ready, n.String())
+		}
+	}
+	// sending a job never blocks, as at most opts.Jobs nodes are running
+	jobs := make(chan string, e.opts.Jobs)
+	results := make(chan execResult)
+	defer close(jobs)
+	for i := 0; i < e.opts.Jobs; i++ {
+		go func() {
+			for name := range jobs {
+				results <- e.runNode(ctx, name)
+			}
+		}()
+	}
+	running := 0
+	for {
+		for len(e.ready) > 0 && running < e.opts.Jobs && (len(e.failed) == 0 || e.opts.KeepGoing) && ctx.Err() == nil {
+			jobs <- e.ready[0]
+			e.ready = e.ready[1:]
+			running++
+		}
+		if running == 0 {
+			break
+		}
+		e.finish(<-results)
+		running--
+	}
+	if len(e.failed) == 0 {
+		return ctx.Err()
+	}
+	execErr := &ExecError{}
+	for _, n := range e.graph.GetNodes() {
+		if err, ok := e.failed[n.String()]; ok {
+			execErr.Failed = append(execErr.Failed, &NodeError{Name: n.String(), Err: err})
+		} else if !e.done[n.String()] {
+			execErr.Skipped = append(execErr.Skipped, n.String())
+		}
+	}
+	return execErr
+}
+
+// runNode runs the commands of the node with the given name, stopping at the first failed command.
+func (e *executor) runNode(ctx context.Context, name string) execResult {
+	var output bytes.Buffer
+	if e.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.opts.Timeout)
+		defer cancel()
+	}
+	for _, command := range e.commands[name] {
+		quiet, ignoreErrors := false, false
+		for len(command) > 0 && strings.IndexByte("@-+", command[0]) >= 0 {
+			quiet, ignoreErrors = quiet || command[0] == '@', ignoreErrors || command[0] == '-'
+			command = strings.TrimSpace(command[1:])
+		}
+		if !quiet {
+			output.WriteString(command + "\n")
+		}
+		err := e.opts.Run(ctx, name, command, &output)
+		if e.opts.Timeout > 0 && ctx.Err() == context.DeadlineExceeded {
+			return execResult{name, output.Bytes(), fmt.Errorf("timed out after %v", e.opts.Timeout)}
+		}
+		if err != nil && !ignoreErrors {
+			return execResult{name, output.Bytes(), err}
+		}
+	}
+	return execResult{name, output.Bytes(), nil}
+}
+
+// finish writes the output of result and records it. If the node succeeded, its dependants whose dependencies all
+// succeeded become ready.
+func (e *executor) finish(result execResult) {
+	e.opts.Output.Write(result.output)
+	if result.err != nil {
+		fmt.Fprintf(e.opts.Output, "depgrapher: %s failed: %v\n", result.name, result.err)
+		e.failed[result.name] = result.err
+		return
+	}
+	e.done[result.name] = true
+	for _, dependant := range e.graph.GetDependants(result.name) {
+		if e.pending[dependant.String()]--; e.pending[dependant.String()] == 0 {
+			e.ready = append(e.ready, dependant.String())
+		}
+	}
+}
+
+// writeSchedule writes the nodes with commands in the order run would start them to opts.Output, grouped into steps
+// of nodes that can run in parallel.
+func (e *executor) writeSchedule() error {
+	// step is the step in which a node can run, which is the first step after all its dependencies with commands
+	step := map[string]int{}
+	steps := 0
+	for _, n := range Sorted(e.graph, TopologicalOrder).GetNodes() {
+		for _, dep := range e.graph.GetDependencies(n.String()) {
+			next := step[dep.String()]
+			if len(e.commands[dep.String()]) > 0 {
+				next++
+			}
+			if next > step[n.String()] {
+				step[n.String()] = next
+			}
+		}
+		if len(e.commands[n.String()]) > 0 && step[n.String()]+1 > steps {
+			steps = step[n.String()] + 1
+		}
+	}
+	w := &errWriter{w: e.opts.Output}
+	for i := 0; i < steps; i++ {
+		w.printf("step %d:\n", i+1)
+		for _, n := range e.graph.GetNodes() {
+			if step[n.String()] == i && len(e.commands[n.String()]) > 0 {
+				w.printf("  %s\n", n.String())
+				for _, command := range e.commands[n.String()] {
+					w.printf("    %s\n", command)
+				}
+			}
+		}
+	}
+	return w.err
+}
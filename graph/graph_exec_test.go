@@ -0,0 +1,223 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package graph
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/SimplicityApks/depgrapher/syntax"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testRecipes = `all: app test
+
+app: main.o util.o
+	cc -o $@ $^
+
+main.o: main.c
+	cc -c $<
+	@echo "built: $@"
+
+util.o: util.c
+	cc -c $<
+test: app
+	./app --test
+`
+
+// recorder is an ExecOptions.Run function recording the run commands and the maximum number of parallel commands.
+type recorder struct {
+	sync.Mutex
+	commands         []string
+	running, maximum int
+	// fail contains the commands that fail
+	fail map[string]bool
+}
+
+func (r *recorder) run(ctx context.Context, name, command string, output io.Writer) error {
+	r.Lock()
+	r.commands = append(r.commands, command)
+	if r.running++; r.running > r.maximum {
+		r.maximum = r.running
+	}
+	r.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	r.Lock()
+	r.running--
+	r.Unlock()
+	if r.fail[command] {
+		return errors.New("exit status 1")
+	}
+	io.WriteString(output, "ran "+name+"\n")
+	return nil
+}
+
+// index returns the index of command in the recorded commands, or -1.
+func (r *recorder) index(command string) int {
+	for i, c := range r.commands {
+		if c == command {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestGraph_FromScanner_recipes(t *testing.T) {
+	g, _ := New().FromScanner(bufio.NewScanner(strings.NewReader(testRecipes)), syntax.Makefile)
+	synced, _ := NewSynced().FromScanner(bufio.NewScanner(strings.NewReader(testRecipes)), syntax.Makefile)
+	for _, graph := range []interface {
+		Interface
+		Attributed
+	}{g, synced} {
+		if recipe := graph.NodeAttributes("main.o")["recipe"]; recipe != "cc -c $<\n@echo \"built: $@\"" {
+			t.Errorf("%T stored the recipe %q", graph, recipe)
+		}
+		if graph.NodeAttributes("all") != nil || graph.GetNode("@echo") != nil ||
+			graph.NodeAttributes("test")["recipe"] != "./app --test" {
+			t.Errorf("%T stored the wrong recipes", graph)
+		}
+	}
+	// like in make, the last recipe for a node wins, also if the rules are read concurrently
+	var rules strings.Builder
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(&rules, "target: dep%d\n\techo %d\n", i, i)
+	}
+	g2, _ := New().FromScanner(bufio.NewScanner(strings.NewReader(rules.String())), syntax.Makefile)
+	synced2, _ := NewSynced().FromScanner(bufio.NewScanner(strings.NewReader(rules.String())), syntax.Makefile)
+	for _, graph := range []Attributed{g2, synced2} {
+		if recipe := graph.NodeAttributes("target")["recipe"]; recipe != "echo 49" {
+			t.Errorf("%T stored the recipe %q instead of the last one", graph, recipe)
+		}
+	}
+	var buffer bytes.Buffer
+	WriteMakefile(g, &buffer, MakefileOptions{})
+	makefile := buffer.String()
+	written, _ := New().FromScanner(bufio.NewScanner(strings.NewReader(makefile)), syntax.Makefile)
+	for _, n := range g.GetNodes() {
+		if written.NodeAttributes(n.String())["recipe"] != g.NodeAttributes(n.String())["recipe"] {
+			t.Errorf("WriteMakefile didn't write the recipe of %s:\n%s", n, makefile)
+		}
+	}
+	if commands := RecipeCommands(g, "app"); len(commands) != 1 || commands[0] != "cc -o app main.o util.o" {
+		t.Errorf("RecipeCommands returned %q", commands)
+	}
+}
+
+func TestExpandCommand(t *testing.T) {
+	const makefile = "app: main.o util.o | outdir\n\tcc -o $@ $^\nmain.o: main.c util.h\n\tcc -c $< -o $@\n" +
+		"util.o: util.c util.h\n\tcc -c $< -o $@\nutil.o: util.c config.h\n"
+	g, _ := New().FromScanner(bufio.NewScanner(strings.NewReader(makefile)), syntax.Makefile)
+	synced, _ := NewSynced().FromScanner(bufio.NewScanner(strings.NewReader(makefile)), syntax.Makefile)
+	for _, graph := range []Interface{g, synced} {
+		expanded := []string{
+			ExpandCommand(graph, "app", "cc -o $@ $^"),
+			ExpandCommand(graph, "main.o", "cc -c $< -o $@"),
+			ExpandCommand(graph, "util.o", "cc -c $< -o $@ # $^ $$HOME"),
+		}
+		expected := []string{
+			"cc -o app main.o util.o",
+			"cc -c main.c -o main.o",
+			"cc -c util.c -o util.o # util.c util.h config.h $HOME",
+		}
+		for i := range expanded {
+			if expanded[i] != expected[i] {
+				t.Errorf("%T: ExpandCommand returned %q instead of %q", graph, expanded[i], expected[i])
+			}
+		}
+	}
+	// the positions are kept by Subgraph
+	if expanded := ExpandCommand(Subgraph(g, g.GetNodes()), "util.o", "$^"); expanded != "util.c util.h config.h" {
+		t.Errorf("ExpandCommand returned %q for a subgraph", expanded)
+	}
+}
+
+func TestExecute(t *testing.T) {
+	g, _ := New().FromScanner(bufio.NewScanner(strings.NewReader(testRecipes)), syntax.Makefile)
+	r := &recorder{}
+	var output bytes.Buffer
+	if err := Execute(context.Background(), g, nil, ExecOptions{Jobs: 2, Run: r.run, Output: &output}); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.commands) != 5 || r.maximum != 2 {
+		t.Errorf("Execute ran %d commands with %d in parallel: %q", len(r.commands), r.maximum, r.commands)
+	}
+	if r.index("cc -c main.c") > r.index("cc -o app main.o util.o") ||
+		r.index("cc -c util.c") > r.index("cc -o app main.o util.o") ||
+		r.index("cc -o app main.o util.o") > r.index("./app --test") {
+		t.Errorf("Execute ran the commands out of order: %q", r.commands)
+	}
+	if !strings.Contains(output.String(), "cc -c main.c\nran main.o\nran main.o\n") ||
+		strings.Contains(output.String(), "@echo") {
+		t.Errorf("Execute wrote the output\n%s", output.String())
+	}
+
+	r = &recorder{}
+	if err := Execute(context.Background(), g, []string{"app"}, ExecOptions{Jobs: 1, Run: r.run}); err != nil ||
+		len(r.commands) != 4 || r.maximum != 1 {
+		t.Errorf("Execute ran %q for app: %v", r.commands, err)
+	}
+}
+
+func TestExecute_failures(t *testing.T) {
+	g, _ := New().FromScanner(bufio.NewScanner(strings.NewReader(
+		"all: a b\na: a1\n\tfail a1\nb: b1\n\tok b1\nb1:\n\tok b2\na1:\n\t-fail ignored\n\tok a2\n")), syntax.Makefile)
+	fail := map[string]bool{"fail a1": true, "fail ignored": true}
+	r := &recorder{fail: fail}
+	err := Execute(context.Background(), g, nil, ExecOptions{Jobs: 1, KeepGoing: true, Run: r.run})
+	var execErr *ExecError
+	if !errors.As(err, &execErr) || len(execErr.Failed) != 1 || execErr.Failed[0].Name != "a" ||
+		strings.Join(execErr.Skipped, " ") != "all" || len(r.commands) != 5 {
+		t.Errorf("Execute with KeepGoing ran %q and returned %v", r.commands, err)
+	}
+	r = &recorder{fail: fail}
+	err = Execute(context.Background(), g, nil, ExecOptions{Jobs: 1, Run: r.run})
+	if !errors.As(err, &execErr) || strings.Join(execErr.Skipped, " ") != "all b" ||
+		err.Error() != "1 failed, 2 skipped: a" {
+		t.Errorf("Execute ran %q and returned %v", r.commands, err)
+	}
+	err = Execute(context.Background(), g, nil, ExecOptions{Timeout: 10 * time.Millisecond,
+		Run: func(ctx context.Context, name, command string, output io.Writer) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}})
+	if !errors.As(err, &execErr) || execErr.Failed[0].Err.Error() != "timed out after 10ms" {
+		t.Errorf("Execute with a timeout returned %v", err)
+	}
+
+	cyclic, _ := New().FromScanner(bufio.NewScanner(strings.NewReader("a: b\nb: a\n")), syntax.Makefile)
+	if err := Execute(context.Background(), cyclic, nil, ExecOptions{}); err == nil ||
+		err.Error() != "dependency cycle: a -> b -> a" {
+		t.Errorf("Execute returned %v for a cycle", err)
+	}
+	if err := Execute(context.Background(), g, []string{"missing"}, ExecOptions{}); err == nil {
+		t.Error("Execute didn't return an error for a missing target")
+	}
+}
+
+func TestExecute_dryRun(t *testing.T) {
+	g, _ := New().FromScanner(bufio.NewScanner(strings.NewReader(testRecipes)), syntax.Makefile)
+	var output bytes.Buffer
+	if err := Execute(context.Background(), g, nil, ExecOptions{DryRun: true, Output: &output,
+		Run: func(context.Context, string, string, io.Writer) error { panic("DryRun ran a command") }}); err != nil {
+		t.Fatal(err)
+	}
+	expected := "step 1:\n  main.o\n    cc -c main.c\n    @echo \"built: main.o\"\n  util.o\n    cc -c util.c\n" +
+		"step 2:\n  app\n    cc -o app main.o util.o\nstep 3:\n  test\n    ./app --test\n"
+	if output.String() != expected {
+		t.Errorf("Execute with DryRun wrote\n%s", output.String())
+	}
+	output.Reset()
+	Execute(context.Background(), g, []string{"util.o"}, ExecOptions{DryRun: true, Output: &output,
+		Commands: TemplateCommands("lint $@")})
+	if output.String() != "step 1:\n  util.c\n    lint util.c\nstep 2:\n  util.o\n    lint util.o\n" {
+		t.Errorf("Execute with TemplateCommands wrote\n%s", output.String())
+	}
+}
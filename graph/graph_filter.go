@@ -0,0 +1,145 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Contains functions that simplify large graphs by removing or merging nodes.
+package graph
+
+import (
+	"regexp"
+)
+
+// Filter returns a new Graph with the nodes of graph for which keep returns true. The removed nodes are bridged: each
+// kept node depends on all kept nodes it reached in graph through removed nodes only, so the kept nodes can still reach
+// each other like before. The attributes of the kept nodes and of the edges between them are copied, bridging edges
+// don't have any. The nodes are declared in the order of graph.
+//
+// This operation calls GetDependencies once for each node of graph. Bridging takes time proportional to the sum of the
+// number of removed nodes and their edges for every kept node depending on removed nodes in the worst case, and time
+// proportional to the number of edges if no kept node does.
+func Filter(graph Interface, keep func(name string) bool) *Graph {
+	kept := map[string]struct{}{}
+	dependencies := map[string][]Node{}
+	for _, n := range graph.GetNodes() {
+		if keep(n.String()) {
+			kept[n.String()] = struct{}{}
+		}
+		dependencies[n.String()] = graph.GetDependencies(n.String())
+	}
+	result := New(uint(len(kept)))
+	attributed, _ := graph.(Attributed)
+	nodes := filterNodes(graph, kept)
+	result.AddNodes(nodes...)
+	for _, n := range nodes {
+		name := n.String()
+		// walk the dependencies of n depth-first, only descending into removed nodes
+		visited := map[string]struct{}{}
+		var walk func(current string)
+		walk = func(current string) {
+			for _, dep := range dependencies[current] {
+				depName := dep.String()
+				if _, ok := kept[depName]; ok {
+					result.AddEdge(name, depName)
+				} else if _, ok := visited[depName]; !ok {
+					visited[depName] = struct{}{}
+					walk(depName)
+				}
+			}
+		}
+		walk(name)
+		if attributed != nil {
+			result.setNodeAttributes(name, attributed.NodeAttributes(name))
+			for _, dep := range dependencies[name] {
+				if _, ok := kept[dep.String()]; ok {
+					result.setEdgeAttributes(edge{source: name, target: dep.String()},
+						attributed.EdgeAttributes(name, dep.String()))
+				}
+			}
+		}
+	}
+	return result
+}
+
+// Collapse returns a new Graph in which all nodes of graph that rename maps to the same name are merged into a single
+// node with that name. The merged node has the dependencies and dependants of all its nodes, without duplicate edges
+// and without the edges between its nodes, and only the attributes they all share. The nodes are declared in the order
+// in which their first node was declared in graph.
+//
+// This operation takes time proportional to the sum of the number of nodes and the number of edges in graph, plus the
+// cost of a rename and a GetDependencies call for each node.
+func Collapse(graph Interface, rename func(name string) string) *Graph {
+	result := New()
+	attributed, _ := graph.(Attributed)
+	names := map[string]string{}
+	nodeAttrs := map[string]map[string]string{}
+	for _, n := range graph.GetNodes() {
+		name := rename(n.String())
+		names[n.String()] = name
+		var attrs map[string]string
+		if attributed != nil {
+			attrs = attributed.NodeAttributes(n.String())
+		}
+		if result.GetNode(name) != nil {
+			nodeAttrs[name] = commonAttributes(nodeAttrs[name], attrs)
+			continue
+		}
+		if name == n.String() {
+			result.AddNode(n)
+		} else {
+			result.AddNode(NewNode(name))
+		}
+		nodeAttrs[name] = attrs
+	}
+	edgeAttrs := map[edge]map[string]string{}
+	for _, n := range graph.GetNodes() {
+		source := names[n.String()]
+		for _, dep := range graph.GetDependencies(n.String()) {
+			target := names[dep.String()]
+			if source == target && n.String() != dep.String() {
+				continue
+			}
+			var attrs map[string]string
+			if attributed != nil {
+				attrs = attributed.EdgeAttributes(n.String(), dep.String())
+			}
+			e := edge{source: source, target: target}
+			if result.HasEdge(source, target) {
+				edgeAttrs[e] = commonAttributes(edgeAttrs[e], attrs)
+				continue
+			}
+			result.AddEdge(source, target)
+			edgeAttrs[e] = attrs
+		}
+	}
+	for name, attrs := range nodeAttrs {
+		result.setNodeAttributes(name, attrs)
+	}
+	for e, attrs := range edgeAttrs {
+		result.setEdgeAttributes(e, attrs)
+	}
+	return result
+}
+
+// RegexpRename returns a rename function for Collapse that replaces the matches of pattern in each name with
+// replacement, which may refer to submatches like regexp.Regexp.ReplaceAllString, and keeps all other names. For
+// example, the pattern `^build/([^/]+)/.*\.o$` with the replacement "$1 objs" merges all object files below
+// build/foo into the node "foo objs".
+func RegexpRename(pattern *regexp.Regexp, replacement string) func(name string) string {
+	return func(name string) string {
+		return pattern.ReplaceAllString(name, replacement)
+	}
+}
+
+// commonAttributes returns the attributes that have the same value in a and b.
+func commonAttributes(a, b map[string]string) map[string]string {
+	var result map[string]string
+	for k, v := range a {
+		if value, ok := b[k]; ok && value == v {
+			if result == nil {
+				result = make(map[string]string)
+			}
+			result[k] = v
+		}
+	}
+	return result
+}
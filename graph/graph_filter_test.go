@@ -0,0 +1,53 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package graph
+
+import (
+	"bufio"
+	"github.com/SimplicityApks/depgrapher/syntax"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	g, _ := New().FromScanner(bufio.NewScanner(strings.NewReader(
+		"app: a.o b.o | dir\na.o: a.c lib.a\nb.o: b.c lib.a\nlib.a: x.o\nx.o: x.c app\n")), syntax.Makefile)
+	g.SetNodeAttribute("app", "label", "the app")
+	filtered := Filter(g, func(name string) bool { return !MatchGlob("*.o", name) })
+	if filtered.String() != "app => dir; app => a.c; app => lib.a; app => b.c; lib.a => app; lib.a => x.c; " {
+		t.Errorf("Filter returned\n%s", filtered)
+	}
+	if filtered.NodeAttributes("app")["label"] != "the app" || filtered.EdgeAttributes("app", "dir")["order-only"] != "true" {
+		t.Error("Filter didn't copy the attributes")
+	}
+	if filtered.EdgeAttributes("app", "lib.a") != nil {
+		t.Error("Filter added attributes to a bridging edge")
+	}
+	if cyclic := Filter(g, func(name string) bool { return name == "lib.a" }); !cyclic.HasEdge("lib.a", "lib.a") {
+		t.Errorf("Filter didn't keep the cycle through removed nodes:\n%s", cyclic)
+	}
+}
+
+func TestCollapse(t *testing.T) {
+	g, _ := New().FromScanner(bufio.NewScanner(strings.NewReader(
+		"all: build/foo/a.o build/foo/b.o build/bar/c.o\nbuild/foo/a.o: a.c build/foo/b.o\n"+
+			"build/foo/b.o: b.c\nbuild/bar/c.o: c.c build/bar/c.o\n.PHONY: all\n")), syntax.Makefile)
+	g.MarkPhony()
+	g.SetNodeAttribute("build/foo/a.o", "color", "red")
+	g.SetNodeAttribute("build/foo/b.o", "color", "red")
+	g.SetNodeAttribute("build/foo/b.o", "shape", "box")
+	collapsed := Collapse(g, RegexpRename(regexp.MustCompile(`^build/([^/]+)/.*\.o$`), "$1 objs"))
+	if collapsed.String() != "all => foo objs; all => bar objs; foo objs => a.c; foo objs => b.c; "+
+		"bar objs => bar objs; bar objs => c.c; " {
+		t.Errorf("Collapse returned\n%s", collapsed)
+	}
+	if attrs := collapsed.NodeAttributes("foo objs"); len(attrs) != 1 || attrs["color"] != "red" {
+		t.Errorf("Collapse merged the attributes into %v", attrs)
+	}
+	if !IsPhony(collapsed, "all") {
+		t.Error("Collapse didn't keep the attributes of an unmerged node")
+	}
+}
@@ -0,0 +1,62 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Contains the glob patterns used to select nodes by name.
+package graph
+
+// MatchGlob returns true if name matches the glob pattern. In pattern, '*' matches any sequence of characters
+// including slashes, so "lib/*" matches all nodes below lib, '?' matches any single character and '\' escapes the
+// following character. All other characters match themselves.
+//
+// This operation takes time proportional to the product of the lengths of pattern and name.
+func MatchGlob(pattern, name string) bool {
+	// backtrack to the last star if the rest doesn't match
+	p, n, starP, starN := 0, 0, -1, 0
+	for n < len(name) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			starP, starN = p, n
+			p++
+			continue
+		case p < len(pattern) && pattern[p] == '?':
+			// match a complete UTF-8 sequence
+			p++
+			n++
+			for n < len(name) && name[n]&0xC0 == 0x80 {
+				n++
+			}
+			continue
+		case p+1 < len(pattern) && pattern[p] == '\\' && pattern[p+1] == name[n]:
+			p += 2
+			n++
+			continue
+		case p < len(pattern) && pattern[p] != '\\' && pattern[p] == name[n]:
+			p++
+			n++
+			continue
+		}
+		if starP < 0 {
+			return false
+		}
+		starN++
+		p, n = starP+1, starN
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// IsGlob returns true if pattern contains any unescaped wildcards, so it may match other names than itself.
+func IsGlob(pattern string) bool {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '*', '?':
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package graph
+
+import (
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	globs := []struct {
+		pattern, name string
+		expected      bool
+	}{
+		{"lib/*", "lib/a/b.o", true},
+		{"lib/*", "app/lib/a.o", false},
+		{"*.o", "main.o", true},
+		{"*.o", "main.c", false},
+		{"a?c", "abc", true},
+		{"a?c", "aüc", true},
+		{"a?c", "ac", false},
+		{"*a*b", "xaaxb", true},
+		{"\\*", "*", true},
+		{"\\*", "a", false},
+		{"", "", true},
+		{"*", "", true},
+	}
+	for _, glob := range globs {
+		if result := MatchGlob(glob.pattern, glob.name); result != glob.expected {
+			t.Errorf("MatchGlob(%q, %q) returned %v", glob.pattern, glob.name, result)
+		}
+	}
+	if !IsGlob("lib/*") || IsGlob("lib/\\*") || IsGlob("main.o") {
+		t.Error("IsGlob didn't detect the wildcards")
+	}
+}
@@ -0,0 +1,323 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Contains the writer of the self-contained interactive HTML report.
+package graph
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// htmlGraph is the data embedded into the HTML report, the JSON interchange format extended by the layout.
+type htmlGraph struct {
+	Width  float64    `json:"width"`
+	Height float64    `json:"height"`
+	Nodes  []htmlNode `json:"nodes"`
+	Edges  []htmlEdge `json:"edges"`
+	Cycles [][]string `json:"cycles"`
+}
+
+type htmlNode struct {
+	jsonNode
+	Label  string  `json:"label"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+type htmlEdge struct {
+	jsonEdge
+	Points []Point `json:"points"`
+}
+
+// WriteHTML writes a single self-contained HTML page to writer, which shows the given graph as laid out by NewLayout
+// and lets the reader explore it without any external resources:
+// nodes can be searched by name or label, clicking a node focuses on its dependencies or dependants, double-clicking
+// a node collapses or expands the nodes only reachable through it, and the nodes and edges of cycles can be
+// highlighted. The graph is embedded in the JSON interchange format of WriteJSON, extended by the layout.
+func WriteHTML(graph Interface, writer io.Writer) error {
+	base := newJSONGraph(graph)
+	layout := NewLayout(graph, LayoutOptions{})
+	data := htmlGraph{Width: layout.Width, Height: layout.Height, Cycles: [][]string{}}
+	// join the layout with the attributes by name, as graph may change between the walks over its nodes
+	nodes := make(map[string]jsonNode, len(base.Nodes))
+	for _, n := range base.Nodes {
+		nodes[n.ID] = n
+	}
+	edges := make(map[[2]string]jsonEdge, len(base.Edges))
+	for _, e := range base.Edges {
+		edges[[2]string{e.Source, e.Target}] = e
+	}
+	for _, n := range layout.Nodes {
+		jn, ok := nodes[n.Name]
+		if !ok {
+			jn = jsonNode{ID: n.Name}
+		}
+		data.Nodes = append(data.Nodes, htmlNode{jsonNode: jn, Label: n.Label, X: n.X, Y: n.Y, Width: n.Width,
+			Height: n.Height})
+	}
+	for _, e := range layout.Edges {
+		je, ok := edges[[2]string{e.Source, e.Target}]
+		if !ok {
+			je = jsonEdge{Source: e.Source, Target: e.Target}
+		}
+		data.Edges = append(data.Edges, htmlEdge{jsonEdge: je, Points: e.Points})
+	}
+	for _, cycle := range Cycles(graph) {
+		var names []string
+		for _, n := range cycle {
+			names = append(names, n.String())
+		}
+		data.Cycles = append(data.Cycles, names)
+	}
+	// json.Marshal escapes '<', '>' and '&', so the data can't end the script element
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	w := &errWriter{w: writer}
+	w.printf("%s", htmlHeader)
+	w.printf("%s", encoded)
+	w.printf("%s", htmlFooter)
+	return w.err
+}
+
+const htmlHeader = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Dependency graph</title>
+<style>
+body { margin: 0; font-family: sans-serif; font-size: 14px; }
+header { position: sticky; top: 0; display: flex; gap: 12px; align-items: center; padding: 8px 12px;
+  background: #f4f4f4; border-bottom: 1px solid #ccc; z-index: 1; }
+header input[type=search] { width: 240px; }
+#status { color: #555; margin-left: auto; }
+main { display: flex; }
+#canvas { flex: 1; overflow: auto; }
+aside { width: 280px; padding: 8px 12px; border-left: 1px solid #ccc; overflow-wrap: anywhere; }
+aside ul { padding-left: 18px; }
+aside li { cursor: pointer; }
+.edges path { fill: none; stroke: #888; }
+.node { cursor: pointer; }
+.node rect { fill: #fff; stroke: #333; }
+.node text { text-anchor: middle; dominant-baseline: central; font-size: 12px; }
+.node.collapsed rect { stroke-dasharray: 4 2; fill: #eee; }
+.node.match rect { fill: #ffeb99; }
+.node.selected rect { stroke: #06c; stroke-width: 2; }
+.dimmed { opacity: 0.25; }
+.show-cycles .node.cyclic rect { stroke: #c00; fill: #fdd; }
+.show-cycles .edges path.cyclic { stroke: #c00; }
+</style>
+</head>
+<body>
+<header>
+<input id="search" type="search" placeholder="Search nodes">
+<label>Focus on <select id="direction">
+<option value="dependencies">dependencies</option>
+<option value="dependants">dependants</option>
+</select></label>
+<button id="reset">Show all</button>
+<label><input id="cycles" type="checkbox"> Highlight cycles</label>
+<span id="status"></span>
+</header>
+<main>
+<div id="canvas">
+<svg id="graph" xmlns="http://www.w3.org/2000/svg">
+<defs><marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="8" markerHeight="8" orient="auto">
+<path d="M 0 0 L 10 5 L 0 10 z" fill="#888"/></marker></defs>
+</svg>
+</div>
+<aside id="details"><p>Click a node to focus on it, double-click it to collapse or expand it.</p></aside>
+</main>
+<script id="graph-data" type="application/json">`
+
+const htmlFooter = `</script>
+<script>
+(function() {
+  "use strict";
+  var data = JSON.parse(document.getElementById("graph-data").textContent);
+  var svgNS = "http://www.w3.org/2000/svg";
+  var svg = document.getElementById("graph");
+  svg.setAttribute("width", data.width);
+  svg.setAttribute("height", data.height);
+  svg.setAttribute("viewBox", "0 0 " + data.width + " " + data.height);
+
+  var nodes = {}, deps = {}, dependants = {}, cycleOf = {};
+  data.nodes.forEach(function(n) { nodes[n.id] = n; deps[n.id] = []; dependants[n.id] = []; });
+  data.edges.forEach(function(e) { deps[e.source].push(e.target); dependants[e.target].push(e.source); });
+  data.cycles.forEach(function(cycle) { cycle.forEach(function(id) { cycleOf[id] = cycle; }); });
+  var state = {focus: null, collapsed: {}};
+
+  function element(name, attributes, parent, text) {
+    var e = document.createElementNS(svgNS, name);
+    Object.keys(attributes).forEach(function(key) { e.setAttribute(key, attributes[key]); });
+    if (text !== undefined) {
+      e.textContent = text;
+    }
+    parent.appendChild(e);
+    return e;
+  }
+
+  var edgeGroup = element("g", {"class": "edges"}, svg);
+  var nodeGroup = element("g", {"class": "nodes"}, svg);
+  data.edges.forEach(function(e) {
+    var path = e.points.map(function(p) { return p.x + " " + p.y; }).join(" L ");
+    e.element = element("path", {"d": "M " + path, "marker-end": "url(#arrow)"}, edgeGroup);
+    element("title", {}, e.element, e.source + " -> " + e.target);
+    if (cycleOf[e.source] && cycleOf[e.source] === cycleOf[e.target]) {
+      e.element.classList.add("cyclic");
+    }
+  });
+  data.nodes.forEach(function(n) {
+    n.element = element("g", {"class": "node"}, nodeGroup);
+    element("title", {}, n.element, n.id);
+    element("rect", {"x": n.x, "y": n.y, "width": n.width, "height": n.height, "rx": 4}, n.element);
+    element("text", {"x": n.x + n.width / 2, "y": n.y + n.height / 2}, n.element, n.label.replace(/\n/g, " "));
+    if (cycleOf[n.id]) {
+      n.element.classList.add("cyclic");
+    }
+    n.element.addEventListener("click", function() { focus(n.id); });
+    n.element.addEventListener("dblclick", function(event) {
+      event.preventDefault();
+      if (state.collapsed[n.id]) {
+        delete state.collapsed[n.id];
+      } else if (deps[n.id].length > 0) {
+        state.collapsed[n.id] = true;
+      }
+      update();
+    });
+  });
+
+  // reach marks all nodes reachable from start in set, following adjacency while allowed returns true
+  function reach(start, adjacency, set, allowed) {
+    var stack = [start];
+    while (stack.length > 0) {
+      var id = stack.pop();
+      if (set[id] || !allowed(id)) {
+        continue;
+      }
+      set[id] = true;
+      adjacency[id].forEach(function(next) { stack.push(next); });
+    }
+  }
+
+  function update() {
+    var scope = null;
+    if (state.focus !== null) {
+      scope = {};
+      reach(state.focus, document.getElementById("direction").value === "dependants" ? dependants : deps, scope,
+        function() { return true; });
+    }
+    var inScope = function(id) { return scope === null || scope[id]; };
+    // the roots are the nodes without dependants in scope, and one node of every cycle that can't be reached
+    var roots = [], reachable = {};
+    data.nodes.forEach(function(n) {
+      if (inScope(n.id) && !dependants[n.id].some(inScope)) {
+        roots.push(n.id);
+        reach(n.id, deps, reachable, inScope);
+      }
+    });
+    data.nodes.forEach(function(n) {
+      if (inScope(n.id) && !reachable[n.id]) {
+        roots.push(n.id);
+        reach(n.id, deps, reachable, inScope);
+      }
+    });
+    // collapsed nodes are shown, but not expanded
+    var visible = {}, expandable = {};
+    data.nodes.forEach(function(n) { expandable[n.id] = []; });
+    data.edges.forEach(function(e) {
+      if (!state.collapsed[e.source]) {
+        expandable[e.source].push(e.target);
+      }
+    });
+    roots.forEach(function(id) { reach(id, expandable, visible, inScope); });
+    var shown = 0;
+    data.nodes.forEach(function(n) {
+      n.element.style.display = visible[n.id] ? "" : "none";
+      n.element.classList.toggle("collapsed", !!state.collapsed[n.id]);
+      n.element.classList.toggle("selected", n.id === state.focus);
+      shown += visible[n.id] ? 1 : 0;
+    });
+    data.edges.forEach(function(e) {
+      var show = visible[e.source] && visible[e.target] && !state.collapsed[e.source];
+      e.element.style.display = show ? "" : "none";
+    });
+    document.getElementById("status").textContent = shown + " of " + data.nodes.length + " nodes shown";
+  }
+
+  function listItems(list, ids) {
+    list.textContent = "";
+    ids.forEach(function(id) {
+      var item = document.createElement("li");
+      item.textContent = id;
+      item.addEventListener("click", function() { focus(id); });
+      list.appendChild(item);
+    });
+  }
+
+  function focus(id) {
+    state.focus = id;
+    update();
+    var n = nodes[id], details = document.getElementById("details");
+    details.textContent = "";
+    var heading = document.createElement("h3");
+    heading.textContent = n.label;
+    details.appendChild(heading);
+    var attributes = n.attributes || {};
+    Object.keys(attributes).sort().forEach(function(key) {
+      var line = document.createElement("div");
+      line.textContent = key + " = " + attributes[key];
+      details.appendChild(line);
+    });
+    if (cycleOf[id]) {
+      var cycle = document.createElement("p");
+      cycle.textContent = "Part of a cycle with " + cycleOf[id].length + " nodes";
+      details.appendChild(cycle);
+    }
+    [["Dependencies", deps[id]], ["Dependants", dependants[id]]].forEach(function(section) {
+      var title = document.createElement("h4");
+      title.textContent = section[0] + " (" + section[1].length + ")";
+      details.appendChild(title);
+      listItems(details.appendChild(document.createElement("ul")), section[1]);
+    });
+    n.element.scrollIntoView({block: "nearest", inline: "nearest"});
+  }
+
+  var search = document.getElementById("search");
+  search.addEventListener("input", function() {
+    var term = search.value.toLowerCase(), matches = [];
+    data.nodes.forEach(function(n) {
+      var match = term !== "" && (n.id.toLowerCase().indexOf(term) >= 0 || n.label.toLowerCase().indexOf(term) >= 0);
+      n.element.classList.toggle("match", match);
+      n.element.classList.toggle("dimmed", term !== "" && !match);
+      if (match) {
+        matches.push(n.id);
+      }
+    });
+    search.matches = matches;
+  });
+  search.addEventListener("keydown", function(event) {
+    if (event.key === "Enter" && search.matches && search.matches.length > 0) {
+      focus(search.matches[0]);
+    }
+  });
+  document.getElementById("direction").addEventListener("change", update);
+  document.getElementById("reset").addEventListener("click", function() {
+    state.focus = null;
+    state.collapsed = {};
+    update();
+  });
+  document.getElementById("cycles").addEventListener("change", function(event) {
+    document.body.classList.toggle("show-cycles", event.target.checked);
+  });
+  update();
+})();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,106 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Contains the reader and writer for the JSON interchange format of graphs.
+package graph
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// jsonGraph is the root object of the JSON format.
+type jsonGraph struct {
+	Nodes []jsonNode `json:"nodes"`
+	Edges []jsonEdge `json:"edges"`
+}
+
+type jsonNode struct {
+	ID         string            `json:"id"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+type jsonEdge struct {
+	Source     string            `json:"source"`
+	Target     string            `json:"target"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// WriteJSON writes the given graph including its attributes to writer in the JSON interchange format.
+//
+// A graph is stored as a single JSON object with a list of nodes and a list of edges:
+//
+//	{
+//	  "nodes": [
+//	    {"id": "all", "attributes": {"label": "Build everything"}},
+//	    {"id": "build"}
+//	  ],
+//	  "edges": [
+//	    {"source": "all", "target": "build", "attributes": {"color": "red"}}
+//	  ]
+//	}
+//
+// The id of a node is the result of its String() method, the optional attributes are string key-value pairs.
+func WriteJSON(graph Interface, writer io.Writer) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(newJSONGraph(graph))
+}
+
+// newJSONGraph returns the JSON representation of graph described in WriteJSON.
+func newJSONGraph(graph Interface) jsonGraph {
+	attributed, _ := graph.(Attributed)
+	result := jsonGraph{Nodes: []jsonNode{}, Edges: []jsonEdge{}}
+	for _, n := range graph.GetNodes() {
+		name := n.String()
+		jn := jsonNode{ID: name}
+		if attributed != nil {
+			jn.Attributes = attributed.NodeAttributes(name)
+		}
+		result.Nodes = append(result.Nodes, jn)
+		for _, dep := range graph.GetDependencies(name) {
+			je := jsonEdge{Source: name, Target: dep.String()}
+			if attributed != nil {
+				je.Attributes = attributed.EdgeAttributes(name, je.Target)
+			}
+			result.Edges = append(result.Edges, je)
+		}
+	}
+	return result
+}
+
+// ReadJSON reads a graph in the JSON interchange format described in WriteJSON from reader, adding its nodes, edges and
+// attributes to g. Nodes that are only referenced by an edge don't need to be listed in the nodes.
+func (g *Graph) ReadJSON(reader io.Reader) (*Graph, error) {
+	var input jsonGraph
+	if err := json.NewDecoder(reader).Decode(&input); err != nil {
+		return g, err
+	}
+	for _, jn := range input.Nodes {
+		if jn.ID == "" {
+			return g, errors.New("ReadJSON: node without id")
+		}
+		g.AddNodes(node(jn.ID))
+		for key, value := range jn.Attributes {
+			g.SetNodeAttribute(jn.ID, key, value)
+		}
+	}
+	for _, je := range input.Edges {
+		if je.Source == "" || je.Target == "" {
+			return g, errors.New("ReadJSON: edge without source or target")
+		}
+		if g.GetNode(je.Source) == nil {
+			g.AddNodes(node(je.Source))
+		}
+		if g.GetNode(je.Target) == nil {
+			g.AddNodes(node(je.Target))
+		}
+		g.AddEdge(je.Source, je.Target)
+		for key, value := range je.Attributes {
+			g.SetEdgeAttribute(je.Source, je.Target, key, value)
+		}
+	}
+	return g, nil
+}
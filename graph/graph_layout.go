@@ -0,0 +1,453 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Contains a layered (Sugiyama-style) layout engine to draw graphs without external tools like Graphviz.
+package graph
+
+import (
+	"sort"
+	"unicode/utf8"
+)
+
+// LayoutOptions configures the sizes used by NewLayout, all in pixels. Zero values are replaced by the defaults.
+type LayoutOptions struct {
+	// CharWidth is the estimated width of a character of a label, defaults to 7
+	CharWidth float64
+	// NodeHeight is the height of every node, defaults to 30
+	NodeHeight float64
+	// NodePadding is the horizontal space between a label and the border of its node, defaults to 10
+	NodePadding float64
+	// NodeSpacing is the minimal horizontal space between two nodes of the same layer, defaults to 20
+	NodeSpacing float64
+	// LayerSpacing is the vertical space between two layers, defaults to 50
+	LayerSpacing float64
+	// Margin is the space around the drawing, defaults to 10
+	Margin float64
+	// Iterations is the number of sweeps used to reduce edge crossings and to align the nodes, defaults to 12
+	Iterations int
+}
+
+// Point is a position in a Layout.
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// NodeLayout is the position of a node in a Layout. X and Y are the coordinates of its top left corner.
+type NodeLayout struct {
+	Name, Label         string
+	Layer               int
+	X, Y, Width, Height float64
+}
+
+// EdgeLayout is the route of an edge in a Layout, Points runs from the border of Source to the border of Target.
+type EdgeLayout struct {
+	Source, Target, Label string
+	Points                []Point
+}
+
+// Layout is a drawing of a graph with the nodes arranged in horizontal layers, dependants above their dependencies.
+// Nodes and Edges are in the order of GetNodes and GetDependencies, so a Layout is deterministic.
+type Layout struct {
+	Width, Height float64
+	Nodes         []NodeLayout
+	Edges         []EdgeLayout
+}
+
+// layoutEdge is an edge of the acyclic layered graph, reversed is set if it points in the opposite direction of the
+// edge of the graph it was created for.
+type layoutEdge struct {
+	from, to int
+	reversed bool
+	// chain contains from, the dummy vertices inserted for edges spanning multiple layers and to
+	chain []int
+}
+
+// layouter holds the state of a single NewLayout call. Vertices are identified by their index, the nodes of the
+// graph come first in the order of GetNodes, followed by the dummy vertices.
+type layouter struct {
+	opts   LayoutOptions
+	names  []string
+	layer  []int
+	width  []float64
+	x      []float64 // the center of each vertex
+	up     [][]int   // the neighbours of each vertex in the layer above
+	down   [][]int   // the neighbours of each vertex in the layer below
+	layers [][]int
+	edges  []*layoutEdge
+}
+
+// NewLayout computes a layered drawing of graph in the style of Sugiyama et al:
+//
+//  1. cycles are broken by reversing the edges found to close a cycle in a depth-first search,
+//  2. every node is assigned to a layer below all of its dependants (longest path layering),
+//  3. edges spanning multiple layers are split by dummy vertices and the order of the vertices in each layer is
+//     improved with the barycenter heuristic to reduce the number of edge crossings,
+//  4. each node is moved as close to the average position of its neighbours as the spacing allows.
+//
+// The size of a node is estimated from the length of its label, which is its "label" attribute or its name.
+//
+// This operation takes time proportional to the number of iterations times the sum of the number of vertices and the
+// number of edges of the layered graph, in which every edge spanning k layers counts k times.
+func NewLayout(graph Interface, opts LayoutOptions) *Layout {
+	defaults := LayoutOptions{CharWidth: 7, NodeHeight: 30, NodePadding: 10, NodeSpacing: 20, LayerSpacing: 50,
+		Margin: 10, Iterations: 12}
+	setDefault := func(value *float64, def float64) {
+		if *value <= 0 {
+			*value = def
+		}
+	}
+	setDefault(&opts.CharWidth, defaults.CharWidth)
+	setDefault(&opts.NodeHeight, defaults.NodeHeight)
+	setDefault(&opts.NodePadding, defaults.NodePadding)
+	setDefault(&opts.NodeSpacing, defaults.NodeSpacing)
+	setDefault(&opts.LayerSpacing, defaults.LayerSpacing)
+	setDefault(&opts.Margin, defaults.Margin)
+	if opts.Iterations <= 0 {
+		opts.Iterations = defaults.Iterations
+	}
+
+	nodes := graph.GetNodes()
+	l := &layouter{opts: opts}
+	index := make(map[string]int, len(nodes))
+	labels := make([]string, len(nodes))
+	for i, n := range nodes {
+		name := n.String()
+		index[name] = i
+		labels[i] = nodeLabel(graph, name)
+		l.names = append(l.names, name)
+		l.width = append(l.width, float64(utf8.RuneCountInString(labels[i]))*opts.CharWidth+2*opts.NodePadding)
+	}
+	l.removeCycles(graph, index)
+	l.assignLayers(len(nodes))
+	l.insertDummies()
+	l.orderLayers()
+	l.assignCoordinates()
+
+	// collect the result
+	layout := &Layout{}
+	top := func(v int) float64 {
+		return opts.Margin + float64(l.layer[v])*(opts.NodeHeight+opts.LayerSpacing)
+	}
+	for v := range nodes {
+		layout.Nodes = append(layout.Nodes, NodeLayout{Name: l.names[v], Label: labels[v], Layer: l.layer[v],
+			X: l.x[v] - l.width[v]/2, Y: top(v), Width: l.width[v], Height: opts.NodeHeight})
+		if right := l.x[v] + l.width[v]/2 + opts.Margin; right > layout.Width {
+			layout.Width = right
+		}
+		if bottom := top(v) + opts.NodeHeight + opts.Margin; bottom > layout.Height {
+			layout.Height = bottom
+		}
+	}
+	routes := make(map[edge][]Point, len(l.edges))
+	for _, e := range l.edges {
+		points := []Point{{l.x[e.from], top(e.from) + opts.NodeHeight}}
+		for _, dummy := range e.chain[1 : len(e.chain)-1] {
+			points = append(points, Point{l.x[dummy], top(dummy) + opts.NodeHeight/2})
+		}
+		points = append(points, Point{l.x[e.to], top(e.to)})
+		source, target := l.names[e.from], l.names[e.to]
+		if e.reversed {
+			source, target = target, source
+			for i, j := 0, len(points)-1; i < j; i, j = i+1, j-1 {
+				points[i], points[j] = points[j], points[i]
+			}
+		}
+		routes[edge{source, target}] = points
+	}
+	for _, n := range nodes {
+		source := n.String()
+		for _, dep := range graph.GetDependencies(source) {
+			target := dep.String()
+			points, ok := routes[edge{source, target}]
+			if !ok {
+				// a self loop, drawn as a small loop on the right side of the node
+				nl := layout.Nodes[index[source]]
+				right := nl.X + nl.Width
+				points = []Point{{right, nl.Y + nl.Height/3}, {right + opts.NodeSpacing/2, nl.Y + nl.Height/3},
+					{right + opts.NodeSpacing/2, nl.Y + 2*nl.Height/3}, {right, nl.Y + 2*nl.Height/3}}
+			}
+			layout.Edges = append(layout.Edges, EdgeLayout{Source: source, Target: target,
+				Label: edgeLabel(graph, source, target), Points: points})
+		}
+	}
+	if len(nodes) == 0 {
+		layout.Width, layout.Height = 2*opts.Margin, 2*opts.Margin
+	}
+	return layout
+}
+
+// removeCycles fills l.edges with the edges of graph except for self loops, reversing the edges that close a cycle
+// in a depth-first search starting at the nodes without dependants.
+func (l *layouter) removeCycles(graph Interface, index map[string]int) {
+	const (
+		unvisited = iota
+		active
+		finished
+	)
+	state := make([]int, len(l.names))
+	var visit func(v int)
+	visit = func(v int) {
+		state[v] = active
+		for _, dep := range graph.GetDependencies(l.names[v]) {
+			w := index[dep.String()]
+			switch {
+			case w == v:
+				// self loops don't take part in the layout
+			case state[w] == active:
+				l.edges = append(l.edges, &layoutEdge{from: w, to: v, reversed: true})
+			default:
+				l.edges = append(l.edges, &layoutEdge{from: v, to: w})
+				if state[w] == unvisited {
+					visit(w)
+				}
+			}
+		}
+		state[v] = finished
+	}
+	for v, name := range l.names {
+		if len(graph.GetDependants(name)) == 0 {
+			visit(v)
+		}
+	}
+	for v := range l.names {
+		if state[v] == unvisited {
+			visit(v)
+		}
+	}
+}
+
+// assignLayers puts every one of the n nodes into the layer below its lowest dependant, then moves the nodes without
+// dependants down to the layer above their highest dependency so they don't cause unnecessarily long edges.
+func (l *layouter) assignLayers(n int) {
+	l.layer = make([]int, n)
+	incoming := make([]int, n)
+	outgoing := make([][]*layoutEdge, n)
+	for _, e := range l.edges {
+		incoming[e.to]++
+		outgoing[e.from] = append(outgoing[e.from], e)
+	}
+	var queue []int
+	for v := 0; v < n; v++ {
+		if incoming[v] == 0 {
+			queue = append(queue, v)
+		}
+	}
+	for len(queue) > 0 {
+		v := queue[0]
+		queue = queue[1:]
+		for _, e := range outgoing[v] {
+			if l.layer[v]+1 > l.layer[e.to] {
+				l.layer[e.to] = l.layer[v] + 1
+			}
+			if incoming[e.to]--; incoming[e.to] == 0 {
+				queue = append(queue, e.to)
+			}
+		}
+	}
+	for v := 0; v < n; v++ {
+		if len(outgoing[v]) == 0 || l.layer[v] != 0 {
+			continue
+		}
+		highest := -1
+		for _, e := range outgoing[v] {
+			if highest < 0 || l.layer[e.to] < highest {
+				highest = l.layer[e.to]
+			}
+		}
+		l.layer[v] = highest - 1
+	}
+}
+
+// insertDummies splits every edge spanning multiple layers into a chain of edges between adjacent layers, fills the
+// neighbours of all vertices and puts them into their layers in index order.
+func (l *layouter) insertDummies() {
+	l.up = make([][]int, len(l.names))
+	l.down = make([][]int, len(l.names))
+	for _, e := range l.edges {
+		e.chain = []int{e.from}
+		for layer := l.layer[e.from] + 1; layer < l.layer[e.to]; layer++ {
+			dummy := len(l.layer)
+			l.layer = append(l.layer, layer)
+			l.width = append(l.width, 0)
+			l.up = append(l.up, nil)
+			l.down = append(l.down, nil)
+			e.chain = append(e.chain, dummy)
+		}
+		e.chain = append(e.chain, e.to)
+		for i := 1; i < len(e.chain); i++ {
+			l.down[e.chain[i-1]] = append(l.down[e.chain[i-1]], e.chain[i])
+			l.up[e.chain[i]] = append(l.up[e.chain[i]], e.chain[i-1])
+		}
+	}
+	for v, layer := range l.layer {
+		for len(l.layers) <= layer {
+			l.layers = append(l.layers, nil)
+		}
+		l.layers[layer] = append(l.layers[layer], v)
+	}
+}
+
+// orderLayers reorders the vertices of each layer to reduce the number of edge crossings, alternately sorting the
+// layers from top to bottom by the average position of their neighbours above and from bottom to top by the average
+// position of their neighbours below. The order with the fewest crossings wins.
+func (l *layouter) orderLayers() {
+	position := make([]float64, len(l.layer))
+	updatePositions := func(layer []int) {
+		for i, v := range layer {
+			position[v] = float64(i)
+		}
+	}
+	for _, layer := range l.layers {
+		updatePositions(layer)
+	}
+	best, bestCrossings := copyLayers(l.layers), l.crossings(position)
+	barycenter := make([]float64, len(l.layer))
+	for iteration := 0; iteration < l.opts.Iterations && bestCrossings > 0; iteration++ {
+		downwards := iteration%2 == 0
+		for i := range l.layers {
+			layer, neighbours := l.layers[i], l.up
+			if !downwards {
+				layer, neighbours = l.layers[len(l.layers)-1-i], l.down
+			}
+			for _, v := range layer {
+				barycenter[v] = position[v]
+				if len(neighbours[v]) > 0 {
+					sum := 0.0
+					for _, w := range neighbours[v] {
+						sum += position[w]
+					}
+					barycenter[v] = sum / float64(len(neighbours[v]))
+				}
+			}
+			sort.SliceStable(layer, func(a, b int) bool { return barycenter[layer[a]] < barycenter[layer[b]] })
+			updatePositions(layer)
+		}
+		if crossings := l.crossings(position); crossings < bestCrossings {
+			best, bestCrossings = copyLayers(l.layers), crossings
+		}
+	}
+	l.layers = best
+}
+
+// crossings returns the number of edge crossings between all adjacent layers for the given vertex positions.
+func (l *layouter) crossings(position []float64) int {
+	total := 0
+	for i := 0; i+1 < len(l.layers); i++ {
+		// count the inversions of the lower ends of the edges sorted by their upper ends with a Fenwick tree
+		var ends [][2]int
+		for _, v := range l.layers[i] {
+			for _, w := range l.down[v] {
+				ends = append(ends, [2]int{int(position[v]), int(position[w])})
+			}
+		}
+		sort.Slice(ends, func(a, b int) bool {
+			return ends[a][0] < ends[b][0] || ends[a][0] == ends[b][0] && ends[a][1] < ends[b][1]
+		})
+		tree := make([]int, len(l.layers[i+1])+1)
+		for count, end := range ends {
+			// add the number of previous edges ending right of this one
+			for j := end[1] + 1; j > 0; j -= j & -j {
+				count -= tree[j]
+			}
+			total += count
+			for j := end[1] + 1; j < len(tree); j += j & -j {
+				tree[j]++
+			}
+		}
+	}
+	return total
+}
+
+// copyLayers returns a deep copy of layers.
+func copyLayers(layers [][]int) [][]int {
+	result := make([][]int, len(layers))
+	for i, layer := range layers {
+		result[i] = append([]int(nil), layer...)
+	}
+	return result
+}
+
+// assignCoordinates sets the horizontal centers of all vertices, keeping the order of each layer and the spacing
+// between its vertices while moving them as close to the average center of their neighbours as possible.
+func (l *layouter) assignCoordinates() {
+	l.x = make([]float64, len(l.layer))
+	target := make([]float64, len(l.layer))
+	for _, layer := range l.layers {
+		// pack the layer from the left
+		for i, v := range layer {
+			target[v] = 0
+			if i > 0 {
+				target[v] = target[layer[i-1]] + l.gap(layer[i-1], v)
+			}
+		}
+		l.place(layer, target)
+	}
+	for iteration := 0; iteration < l.opts.Iterations; iteration++ {
+		downwards := iteration%2 == 0
+		for i := range l.layers {
+			layer, neighbours := l.layers[i], l.up
+			if !downwards {
+				layer, neighbours = l.layers[len(l.layers)-1-i], l.down
+			}
+			for _, v := range layer {
+				target[v] = l.x[v]
+				if len(neighbours[v]) > 0 {
+					sum := 0.0
+					for _, w := range neighbours[v] {
+						sum += l.x[w]
+					}
+					target[v] = sum / float64(len(neighbours[v]))
+				}
+			}
+			l.place(layer, target)
+		}
+	}
+	// move the drawing to the margin
+	left := 0.0
+	for v := range l.layer {
+		if v == 0 || l.x[v]-l.width[v]/2 < left {
+			left = l.x[v] - l.width[v]/2
+		}
+	}
+	for v := range l.x {
+		l.x[v] += l.opts.Margin - left
+	}
+}
+
+// gap returns the minimal distance between the centers of the adjacent vertices v and w of a layer.
+func (l *layouter) gap(v, w int) float64 {
+	return (l.width[v]+l.width[w])/2 + l.opts.NodeSpacing
+}
+
+// place sets the centers of the vertices of layer as close to their targets as possible in the least squares sense
+// while keeping their order and the gaps between them. Subtracting the accumulated gaps turns this into an isotonic
+// regression, which is solved by pooling adjacent violators.
+func (l *layouter) place(layer []int, target []float64) {
+	type block struct {
+		sum   float64
+		count int
+	}
+	offsets := make([]float64, len(layer))
+	var blocks []block
+	for i, v := range layer {
+		if i > 0 {
+			offsets[i] = offsets[i-1] + l.gap(layer[i-1], v)
+		}
+		blocks = append(blocks, block{target[v] - offsets[i], 1})
+		for len(blocks) > 1 {
+			last, previous := blocks[len(blocks)-1], blocks[len(blocks)-2]
+			if previous.sum/float64(previous.count) <= last.sum/float64(last.count) {
+				break
+			}
+			blocks = append(blocks[:len(blocks)-2], block{previous.sum + last.sum, previous.count + last.count})
+		}
+	}
+	i := 0
+	for _, b := range blocks {
+		for j := 0; j < b.count; j, i = j+1, i+1 {
+			l.x[layer[i]] = b.sum/float64(b.count) + offsets[i]
+		}
+	}
+}
@@ -0,0 +1,198 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package graph
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"github.com/SimplicityApks/depgrapher/syntax"
+	"strings"
+	"testing"
+)
+
+// assertValidLayout checks that no two nodes of layout overlap and that all nodes are inside its bounds.
+func assertValidLayout(t *testing.T, layout *Layout) {
+	for i, a := range layout.Nodes {
+		if a.X < 0 || a.Y < 0 || a.X+a.Width > layout.Width || a.Y+a.Height > layout.Height {
+			t.Errorf("node %s is outside of the layout: %+v", a.Name, a)
+		}
+		for _, b := range layout.Nodes[i+1:] {
+			if a.X < b.X+b.Width && b.X < a.X+a.Width && a.Y < b.Y+b.Height && b.Y < a.Y+a.Height {
+				t.Errorf("nodes %s and %s overlap: %+v %+v", a.Name, b.Name, a, b)
+			}
+		}
+	}
+}
+
+func TestNewLayout(t *testing.T) {
+	g, _ := New().FromScanner(bufio.NewScanner(strings.NewReader(
+		"all: build install test\nbuild: prepare compile pack\ntest: build compile\ninstall: pack\n")), syntax.Makefile)
+	layout := NewLayout(g, LayoutOptions{})
+	assertValidLayout(t, layout)
+	if len(layout.Nodes) != 7 || len(layout.Edges) != 9 {
+		t.Fatalf("NewLayout returned %d nodes and %d edges", len(layout.Nodes), len(layout.Edges))
+	}
+	nodes := map[string]NodeLayout{}
+	for _, n := range layout.Nodes {
+		nodes[n.Name] = n
+	}
+	for _, e := range layout.Edges {
+		source, target := nodes[e.Source], nodes[e.Target]
+		if source.Layer >= target.Layer {
+			t.Errorf("edge %s -> %s doesn't point downwards", e.Source, e.Target)
+		}
+		first, last := e.Points[0], e.Points[len(e.Points)-1]
+		if first.Y != source.Y+source.Height || last.Y != target.Y {
+			t.Errorf("edge %s -> %s doesn't connect its nodes: %v", e.Source, e.Target, e.Points)
+		}
+		if len(e.Points) != target.Layer-source.Layer+1 {
+			t.Errorf("edge %s -> %s spanning %d layers has %d points", e.Source, e.Target,
+				target.Layer-source.Layer, len(e.Points))
+		}
+	}
+	if nodes["all"].Layer != 0 || nodes["test"].Layer != 1 || nodes["build"].Layer != 2 || nodes["pack"].Layer != 3 {
+		t.Errorf("NewLayout assigned wrong layers: %+v", layout.Nodes)
+	}
+	// a complete bipartite graph of two nodes on each side can be drawn with a single crossing
+	g, _ = New().FromScanner(bufio.NewScanner(strings.NewReader("a: d c\nb: c\n")), syntax.Makefile)
+	layout = NewLayout(g, LayoutOptions{})
+	for _, n := range layout.Nodes {
+		nodes[n.Name] = n
+	}
+	if (nodes["a"].X < nodes["b"].X) != (nodes["d"].X < nodes["c"].X) {
+		t.Errorf("NewLayout didn't remove the crossing: %+v", layout.Nodes)
+	}
+}
+
+func TestNewLayout_cycles(t *testing.T) {
+	g, _ := New().FromScanner(bufio.NewScanner(strings.NewReader("a: b\nb: c\nc: a c\n")), syntax.Makefile)
+	layout := NewLayout(g, LayoutOptions{})
+	assertValidLayout(t, layout)
+	if len(layout.Edges) != 4 {
+		t.Fatalf("NewLayout returned %d edges instead of 4", len(layout.Edges))
+	}
+	for _, e := range layout.Edges {
+		if e.Source == "c" && e.Target == "a" {
+			// the reversed edge still has to run from its source to its target
+			if first := e.Points[0]; first.Y != layout.Nodes[2].Y {
+				t.Errorf("the edge closing the cycle starts at %v", first)
+			}
+		}
+	}
+	if empty := NewLayout(New(), LayoutOptions{}); len(empty.Nodes) != 0 || empty.Width <= 0 {
+		t.Errorf("NewLayout returned %+v for an empty graph", empty)
+	}
+	assertValidLayout(t, NewLayout(setupLevelGraph(6), LayoutOptions{}))
+}
+
+func TestWriteSVG(t *testing.T) {
+	g, _ := New().FromScanner(bufio.NewScanner(strings.NewReader("all: build <test>\nbuild: all\n")), syntax.Makefile)
+	g.SetNodeAttribute("build", "label", "Build & pack")
+	var buffer bytes.Buffer
+	if err := WriteSVG(g, &buffer); err != nil {
+		t.Fatal(err)
+	}
+	if rects := xmlElements(t, buffer.Bytes(), "rect"); len(rects) != 3 {
+		t.Errorf("WriteSVG wrote %d nodes instead of 3", len(rects))
+	}
+	if paths := xmlElements(t, buffer.Bytes(), "path"); len(paths) != 4 {
+		// three edges and the arrow head
+		t.Errorf("WriteSVG wrote %d paths instead of 4", len(paths))
+	}
+	for _, text := range []string{"Build &amp; pack", "&lt;test&gt;"} {
+		if !strings.Contains(buffer.String(), text) {
+			t.Errorf("WriteSVG didn't write %q:\n%s", text, buffer.String())
+		}
+	}
+}
+
+// htmlData returns the graph data embedded in a page written by WriteHTML.
+func htmlData(t *testing.T, page string) htmlGraph {
+	t.Helper()
+	start := strings.Index(page, "application/json\">") + len("application/json\">")
+	end := strings.Index(page[start:], "</script>")
+	if start < len("application/json\">") || end < 0 {
+		t.Fatalf("WriteHTML didn't embed the graph data:\n%s", page)
+	}
+	var data htmlGraph
+	if err := json.Unmarshal([]byte(page[start:start+end]), &data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// reversingGraph is a Graph returning its nodes and dependencies in reverse order on every other call.
+type reversingGraph struct {
+	*Graph
+	calls int
+}
+
+func (g *reversingGraph) reverse(nodes []Node) []Node {
+	if g.calls++; g.calls%2 == 0 {
+		for i, j := 0, len(nodes)-1; i < j; i, j = i+1, j-1 {
+			nodes[i], nodes[j] = nodes[j], nodes[i]
+		}
+	}
+	return nodes
+}
+
+func (g *reversingGraph) GetNodes() []Node {
+	return g.reverse(g.Graph.GetNodes())
+}
+
+func (g *reversingGraph) GetDependencies(name string) []Node {
+	return g.reverse(g.Graph.GetDependencies(name))
+}
+
+func TestWriteHTML_changingOrder(t *testing.T) {
+	g, _ := New().FromScanner(bufio.NewScanner(strings.NewReader("all: a b c\na: b c\n")), syntax.Makefile)
+	for _, n := range g.GetNodes() {
+		g.SetNodeAttribute(n.String(), "name", n.String())
+		for _, dep := range g.GetDependencies(n.String()) {
+			g.SetEdgeAttribute(n.String(), dep.String(), "edge", n.String()+" "+dep.String())
+		}
+	}
+	var buffer bytes.Buffer
+	if err := WriteHTML(&reversingGraph{Graph: g}, &buffer); err != nil {
+		t.Fatal(err)
+	}
+	data := htmlData(t, buffer.String())
+	for _, n := range data.Nodes {
+		if n.Attributes["name"] != n.ID || n.Label != n.ID {
+			t.Errorf("WriteHTML mixed up the node %s with %v", n.ID, n.Attributes)
+		}
+	}
+	for _, e := range data.Edges {
+		if e.Attributes["edge"] != e.Source+" "+e.Target {
+			t.Errorf("WriteHTML mixed up the edge %s -> %s with %v", e.Source, e.Target, e.Attributes)
+		}
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	g, _ := New().FromScanner(bufio.NewScanner(strings.NewReader("all: build </script>\nbuild: all\n")), syntax.Makefile)
+	g.SetNodeAttribute("build", "label", "Build")
+	var buffer bytes.Buffer
+	if err := WriteHTML(g, &buffer); err != nil {
+		t.Fatal(err)
+	}
+	page := buffer.String()
+	data := htmlData(t, page)
+	if len(data.Nodes) != 3 || len(data.Edges) != 3 || data.Nodes[2].ID != "</script>" {
+		t.Errorf("WriteHTML embedded the wrong graph: %+v", data)
+	}
+	if data.Nodes[1].Label != "Build" || data.Nodes[1].Width <= 0 || len(data.Edges[0].Points) < 2 {
+		t.Errorf("WriteHTML embedded an incomplete layout: %+v", data)
+	}
+	if len(data.Cycles) != 1 || len(data.Cycles[0]) != 2 {
+		t.Errorf("WriteHTML embedded the cycles %v", data.Cycles)
+	}
+	for _, external := range []string{"src=", "href="} {
+		if strings.Contains(page, external) {
+			t.Errorf("WriteHTML references an external resource with %s", external)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Contains the writer of normalized Makefiles.
+package graph
+
+import (
+	"github.com/SimplicityApks/depgrapher/syntax"
+	"io"
+	"strings"
+)
+
+// MakefileOptions configures the output of WriteMakefile.
+type MakefileOptions struct {
+	// Width is the maximal length of a line, longer rules are continued on the next line with a backslash.
+	// Zero or a negative Width disables wrapping.
+	Width int
+	// Phony adds a .PHONY rule listing all phony targets (see IsPhony) in front of the other rules
+	Phony bool
+}
+
+// WriteMakefile writes the given graph to writer as a Makefile fragment with one rule per target, like
+//
+//	target: dep1 dep2 | orderonly1
+//
+// Edges with the attribute "order-only" set to "true" are written as order-only prerequisites after a pipe, as read by
+// FromScanner with syntax.Makefile. Names are escaped like syntax.Makefile does, so the result can be read back by make
+// and FromScanner. Nodes without any edges are written as targets without prerequisites. The "recipe" attribute of a
+// node, as stored by FromScanner, is written as the recipe of its rule.
+// Returns the first error encountered while writing.
+func WriteMakefile(graph Interface, writer io.Writer, opts MakefileOptions) error {
+	w := &errWriter{w: writer}
+	nodes := graph.GetNodes()
+	if opts.Phony {
+		var phony []string
+		for _, n := range nodes {
+			if n.String() != ".PHONY" && IsPhony(graph, n.String()) {
+				phony = append(phony, syntax.Makefile.Quote(n.String()))
+			}
+		}
+		if len(phony) > 0 {
+			writeMakefileRule(w, ".PHONY", phony, nil, opts.Width)
+		}
+	}
+	attributed, _ := graph.(Attributed)
+	for _, n := range nodes {
+		name := n.String()
+		if opts.Phony && name == ".PHONY" {
+			continue
+		}
+		var recipe string
+		if attributed != nil {
+			recipe = attributed.NodeAttributes(name)["recipe"]
+		}
+		dependencies := graph.GetDependencies(name)
+		if len(dependencies) == 0 {
+			if len(graph.GetDependants(name)) > 0 && recipe == "" {
+				continue
+			}
+			w.printf("%s:\n", syntax.Makefile.Quote(name))
+		} else {
+			var normal, orderOnly []string
+			for _, dep := range dependencies {
+				quoted := syntax.Makefile.Quote(dep.String())
+				if attributed != nil && attributed.EdgeAttributes(name, dep.String())["order-only"] == "true" {
+					orderOnly = append(orderOnly, quoted)
+				} else {
+					normal = append(normal, quoted)
+				}
+			}
+			writeMakefileRule(w, syntax.Makefile.Quote(name), normal, orderOnly, opts.Width)
+		}
+		if recipe != "" {
+			w.printf("\t%s\n", strings.Replace(recipe, "\n", "\n\t", -1))
+		}
+	}
+	return w.err
+}
+
+// writeMakefileRule writes a rule for the given quoted target and prerequisites, continuing the line with a backslash
+// before a prerequisite that would exceed width.
+func writeMakefileRule(w *errWriter, target string, normal, orderOnly []string, width int) {
+	line := target + ":"
+	words := normal
+	if len(orderOnly) > 0 {
+		words = append(append(append([]string(nil), normal...), "|"), orderOnly...)
+	}
+	for _, word := range words {
+		// the continued line needs space for the trailing " \"
+		if width > 0 && len(line)+1+len(word)+2 > width && len(line) > 4 {
+			w.printf("%s \\\n", line)
+			line = "   "
+		}
+		line += " " + word
+	}
+	w.printf("%s\n", line)
+}
@@ -6,6 +6,8 @@
 package graph
 
 import (
+	"errors"
+	"fmt"
 	"github.com/SimplicityApks/depgrapher/syntax"
 	"io"
 	"os"
@@ -14,8 +16,18 @@ import (
 	"strings"
 )
 
-// nodeFinished is a set that contains all the nodes which have already been printed. This is global for simplicity (& laziness).
-var nodeFinished map[Node]struct{}
+// errWriter wraps an io.Writer and remembers the first error, so that a sequence of writes only needs one error check.
+// All writes after an error are skipped.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (w *errWriter) printf(format string, args ...interface{}) {
+	if w.err == nil {
+		_, w.err = fmt.Fprintf(w.w, format, args...)
+	}
+}
 
 func insertIntoString(s *string, offset int, insertion string) *string {
 	var str string
@@ -48,14 +60,52 @@ func printDepTreeArrows(line1, line2 *string, fieldstart, fieldlen int, midpoint
 	return line1, line2
 }
 
-func printDepTreeLevel(g Interface, n Node, out []*string, rightOffset int) (modout []*string, width int) {
-	dependencies := g.GetDependencies(n.String())
+// TreeStyle selects the text layout of RenderTree.
+type TreeStyle int
+
+const (
+	// ArtStyle centers each node above its dependencies, connected with ASCII arrows.
+	ArtStyle TreeStyle = iota
+	// IndentStyle lists each dependency indented below its dependant with box-drawing lines like the tree command.
+	IndentStyle
+	// NpmStyle lists the dependencies like IndentStyle, in the more compact layout of npm ls.
+	NpmStyle
+)
+
+// TreeOptions configure the text output of RenderTree.
+type TreeOptions struct {
+	// Style is the layout of the tree, defaults to the ASCII art of ArtStyle.
+	Style TreeStyle
+	// Width is the maximum width of the ArtStyle output lines, wider trees are wrapped. Zero disables wrapping.
+	Width int
+	// RepeatedMarker marks the nodes whose dependencies have already been printed. In ArtStyle it is prefixed to the
+	// name and defaults to "&", in the indented styles it is appended and defaults to "(*)" or "deduped" for NpmStyle.
+	RepeatedMarker string
+	// Root is the name of the node whose dependency tree is rendered. Defaults to the whole graph.
+	Root string
+	// MaxDepth limits the number of dependency levels printed below the roots in the indented styles, zero means
+	// unlimited.
+	MaxDepth int
+	// Color highlights phony nodes and nodes that are part of a cycle with ANSI escape codes in the indented styles.
+	Color bool
+}
+
+// treeRenderer holds the state of a single RenderTree call, so that concurrent calls don't interfere.
+type treeRenderer struct {
+	graph Interface
+	// finished is a set that contains the names of all the nodes which have already been printed
+	finished map[string]struct{}
+	marker   string
+}
+
+func (r *treeRenderer) printDepTreeLevel(n Node, out []*string, rightOffset int) (modout []*string, width int) {
+	dependencies := r.graph.GetDependencies(n.String())
 	name := " " + n.String() + " "
-	if _, finished := nodeFinished[n]; finished {
-		name = " &" + n.String() + " "
+	if _, finished := r.finished[n.String()]; finished {
+		name = " " + r.marker + n.String() + " "
 		dependencies = nil
 	} else {
-		nodeFinished[n] = struct{}{}
+		r.finished[n.String()] = struct{}{}
 	}
 	if len(dependencies) == 0 {
 		if len(out) == 0 {
@@ -79,7 +129,7 @@ func printDepTreeLevel(g Interface, n Node, out []*string, rightOffset int) (mod
 	// save the midpoints to connect the arrows to
 	depMids := make([]int, len(dependencies))
 	for i, dep := range dependencies {
-		out, locWidth = printDepTreeLevel(g, dep, out, rightOffset+depWidth)
+		out, locWidth = r.printDepTreeLevel(dep, out, rightOffset+depWidth)
 		depMids[i] = rightOffset + depWidth + locWidth/2
 		depWidth += locWidth
 	}
@@ -110,72 +160,138 @@ func printDepTreeLevel(g Interface, n Node, out []*string, rightOffset int) (mod
 	return modout, len(name)
 }
 
-// PrintDepTree pretty prints the dependency tree of the specified startNode to stdout.
-func PrintDepTree(graph Interface, start Node) {
-	if start == nil {
-		panic("printDepTree: start should not be nil!")
+// RenderTree writes the dependency tree of graph to writer as text in the style configured by the given options.
+// Nodes whose dependencies have already been printed are marked with the RepeatedMarker instead of being expanded
+// again. If no Root is given, the trees of all nodes without dependants are rendered next to each other, followed by
+// the nodes only reachable through cycles.
+// Returns an error if the Root is not in graph or writing fails.
+func RenderTree(writer io.Writer, graph Interface, opts TreeOptions) error {
+	if opts.Style == IndentStyle || opts.Style == NpmStyle {
+		return renderIndentedTree(writer, graph, opts)
 	}
-	nodeFinished = map[Node]struct{}{}
-	out := wrapToStdout(printDepTreeLevel(graph, start, make([]*string, 1), 0))
-	for _, lineptr := range out {
-		println(*lineptr)
+	r := &treeRenderer{graph: graph, finished: map[string]struct{}{}, marker: opts.RepeatedMarker}
+	if r.marker == "" {
+		r.marker = "&"
+	}
+	var out []*string
+	var width int
+	if opts.Root != "" {
+		start := graph.GetNode(opts.Root)
+		if start == nil {
+			return errors.New("RenderTree: root node " + opts.Root + " not found")
+		}
+		out, width = r.printDepTreeLevel(start, make([]*string, 1), 0)
+	} else {
+		if len(graph.GetNodes()) == 0 {
+			_, err := io.WriteString(writer, "{empty graph}\n")
+			return err
+		}
+		// make a copy of our graph with a virtual root node depending on all roots
+		fullGraph := graph.Copy()
+		fullGraph.AddNode(node("_all"), treeRoots(graph)...)
+		r.graph = fullGraph
+		out, width = r.printDepTreeLevel(fullGraph.GetNode("_all"), make([]*string, 1), 0)
+		// omit the virtual root and its arrows
+		out = out[3:]
+	}
+	w := &errWriter{w: writer}
+	for _, lineptr := range wrapLines(out, width, opts.Width) {
+		if lineptr != nil {
+			w.printf("%s\n", strings.TrimRight(*lineptr, " "))
+		} else {
+			w.printf("\n")
+		}
 	}
+	return w.err
 }
 
-// PrintFullDepTree prints the dependency tree of the whole graph to stdout.
-func PrintFullDepTree(graph Interface) {
-	if len(graph.GetNodes()) == 0 {
-		println("{empty graph}")
-		return
+// treeRoots returns the names of all nodes of graph without dependants, followed by a node of each cycle that is not
+// reachable from them, so that every node is part of a tree.
+func treeRoots(graph Interface) []string {
+	var roots []string
+	reached := map[string]struct{}{}
+	addRoot := func(name string) {
+		roots = append(roots, name)
+		queue := []string{name}
+		reached[name] = struct{}{}
+		for i := 0; i < len(queue); i++ {
+			for _, dep := range graph.GetDependencies(queue[i]) {
+				if _, ok := reached[dep.String()]; !ok {
+					reached[dep.String()] = struct{}{}
+					queue = append(queue, dep.String())
+				}
+			}
+		}
 	}
-	// make a copy of our graph
-	fullGraph := graph.Copy()
-	var allDeps []string
-	for _, n := range fullGraph.GetNodes() {
-		if len(fullGraph.GetDependants(n.String())) == 0 {
-			allDeps = append(allDeps, n.String())
+	nodes := graph.GetNodes()
+	for _, n := range nodes {
+		if len(graph.GetDependants(n.String())) == 0 {
+			addRoot(n.String())
 		}
 	}
-	fullGraph.AddNode(node("_all"), allDeps...)
-	nodeFinished = map[Node]struct{}{}
-	out, width := printDepTreeLevel(fullGraph, fullGraph.GetNode("_all"), make([]*string, 1), 0)
-	out = wrapToStdout(out[3:], width)
-	for _, lineptr := range out {
-		println(*lineptr)
+	for _, n := range nodes {
+		if _, ok := reached[n.String()]; !ok {
+			addRoot(n.String())
+		}
 	}
+	return roots
 }
 
-// wrapToStdout wraps the given output array to the size of os.Stdout.
-func wrapToStdout(out []*string, width int) []*string {
-	// wrap the lines if our output buffer is too small for the width of the full graph
-	stdoutWidth, err := getStdoutWidth()
-	if err != nil {
-		panic("printDepTree: unable to get size of stdout: " + err.Error())
+// PrintDepTree pretty prints the dependency tree of the specified startNode to stdout, wrapped to the terminal width.
+func PrintDepTree(graph Interface, start Node) error {
+	if start == nil {
+		return errors.New("PrintDepTree: start should not be nil")
 	}
-	if stdoutWidth <= 0 { // some terminals have approximately infinite buffer size
-		println("printDepTree: size of stdout is zero!")
+	return RenderTree(os.Stdout, graph, TreeOptions{Width: TerminalWidth(), Root: start.String()})
+}
+
+// PrintFullDepTree prints the dependency tree of the whole graph to stdout, wrapped to the terminal width.
+func PrintFullDepTree(graph Interface) error {
+	return RenderTree(os.Stdout, graph, TreeOptions{Width: TerminalWidth()})
+}
+
+// wrapLines wraps the given output array of the given width to lines of at most maxWidth characters.
+// The output is not wrapped if maxWidth is zero or less.
+func wrapLines(out []*string, width, maxWidth int) []*string {
+	if maxWidth <= 0 { // some terminals have approximately infinite buffer size
 		return out
 	}
+	// wrap the lines if our output buffer is too small for the width of the full graph
 	startHeight := 0
-	for width > stdoutWidth {
+	for width > maxWidth {
 		emptyLine := ""
 		out = append(out, &emptyLine)
 		height := len(out)
 		// TODO: think of a nicer wrapping method
 		for index := startHeight; index < height; index++ {
 			line := *out[index]
-			if len(line) > stdoutWidth {
-				part1, part2 := line[:stdoutWidth], line[stdoutWidth:]
+			if len(line) > maxWidth {
+				part1, part2 := line[:maxWidth], line[maxWidth:]
 				out[index] = &part1
 				out = append(out, &part2)
 			}
 		}
 		startHeight = height
-		width -= stdoutWidth
+		width -= maxWidth
 	}
 	return out
 }
 
+// DefaultWidth is the terminal width assumed by the text output functions if it can't be determined.
+const DefaultWidth = 80
+
+// TerminalWidth returns the width of the stdout window. If it can't be queried, e.g. because stdin is not a terminal
+// in a pipeline or cron job, the COLUMNS environment variable is used, falling back to DefaultWidth.
+func TerminalWidth() int {
+	if width, err := getStdoutWidth(); err == nil {
+		return width
+	}
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && width > 0 {
+		return width
+	}
+	return DefaultWidth
+}
+
 // getStdoutWidth returns the width of the stdout window.
 func getStdoutWidth() (width int, err error) {
 	cmd := exec.Command("stty", "size")
@@ -184,34 +300,152 @@ func getStdoutWidth() (width int, err error) {
 	if err != nil {
 		return -1, err
 	}
-	widthstring := strings.Split(string(out), " ")[1]
-	return strconv.Atoi(widthstring[:len(widthstring)-1])
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		return -1, errors.New("getStdoutWidth: unexpected output of stty size: " + string(out))
+	}
+	return strconv.Atoi(fields[1])
 }
 
 // WriteGraph writes a machine-readable version of the graph to writer, matching the given syntax.
-func WriteGraph(graph Interface, writer io.Writer, syntax *syntax.Syntax) {
-	writer.Write(append([]byte(syntax.GraphPrefix), '\n'))
+// Names are quoted and escaped according to the Quoting of the syntax, so that the output can be read back with
+// FromScanner. Nodes without any edges are written as a single quoted name for syntaxes with syntax.QuoteDouble, and
+// as a source without targets otherwise.
+// Returns the first error encountered while writing.
+func WriteGraph(graph Interface, writer io.Writer, syntax *syntax.Syntax) error {
+	w := &errWriter{w: writer}
+	w.printf("%s\n", syntax.GraphPrefix)
 	for _, node := range graph.GetNodes() {
+		name := syntax.Quote(node.String())
 		dependencies := graph.GetDependencies(node.String())
 		if len(dependencies) > 0 {
-			writer.Write([]byte(syntax.EdgePrefix + "\"" + node.String() + "\"" + syntax.EdgeInfix))
+			w.printf("%s%s%s", syntax.EdgePrefix, name, syntax.EdgeInfix)
 			for index, dep := range dependencies {
-				writer.Write([]byte("\"" + dep.String() + "\""))
+				w.printf("%s", syntax.Quote(dep.String()))
 				if index < len(dependencies)-1 {
 					if syntax.TargetDelimiter == "" {
-						writer.Write([]byte(syntax.EdgeSuffix + "\n" + syntax.EdgePrefix + "\"" + node.String() + "\"" + syntax.EdgeInfix))
+						w.printf("%s\n%s%s%s", syntax.EdgeSuffix, syntax.EdgePrefix, name, syntax.EdgeInfix)
 					} else {
-						writer.Write([]byte(syntax.TargetDelimiter))
+						w.printf("%s", syntax.TargetDelimiter)
 					}
 				}
 			}
-			writer.Write(append([]byte(syntax.EdgeSuffix), '\n'))
+			w.printf("%s\n", syntax.EdgeSuffix)
+		} else if len(graph.GetDependants(node.String())) == 0 {
+			if syntax.Quoted(name) {
+				w.printf("%s%s%s\n", syntax.EdgePrefix, name, syntax.EdgeSuffix)
+			} else {
+				w.printf("%s%s%s%s\n", syntax.EdgePrefix, name, syntax.EdgeInfix, syntax.EdgeSuffix)
+			}
 		}
 	}
-	writer.Write([]byte(syntax.GraphSuffix))
+	w.printf("%s", syntax.GraphSuffix)
+	return w.err
 }
 
 // WriteDot writes the given graph to the given io.Writer in dot language syntax.
-func WriteDot(graph Interface, writer io.Writer) {
-	WriteGraph(graph, writer, syntax.Dot)
+// Returns the first error encountered while writing.
+func WriteDot(graph Interface, writer io.Writer) error {
+	return WriteGraph(graph, writer, syntax.Dot)
+}
+
+// WriteMermaid writes the given graph to writer as a Mermaid flowchart, which is rendered natively in Markdown by many
+// code hosting sites. Nodes are labelled with their "label" attribute, or their name if they don't have one.
+func WriteMermaid(graph Interface, writer io.Writer) error {
+	nodes := graph.GetNodes()
+	ids := identifiers(nodes)
+	w := &errWriter{w: writer}
+	w.printf("flowchart TD\n")
+	for _, n := range nodes {
+		w.printf("    %s[\"%s\"]\n", ids[n.String()], escapeMermaid(nodeLabel(graph, n.String())))
+	}
+	for _, n := range nodes {
+		for _, dep := range graph.GetDependencies(n.String()) {
+			if label := edgeLabel(graph, n.String(), dep.String()); label != "" {
+				w.printf("    %s -->|\"%s\"| %s\n", ids[n.String()], escapeMermaid(label), ids[dep.String()])
+			} else {
+				w.printf("    %s --> %s\n", ids[n.String()], ids[dep.String()])
+			}
+		}
+	}
+	return w.err
+}
+
+// WritePlantUML writes the given graph to writer as a PlantUML diagram. Nodes are labelled with their "label"
+// attribute, or their name if they don't have one.
+func WritePlantUML(graph Interface, writer io.Writer) error {
+	nodes := graph.GetNodes()
+	ids := identifiers(nodes)
+	w := &errWriter{w: writer}
+	w.printf("@startuml\n")
+	for _, n := range nodes {
+		w.printf("rectangle \"%s\" as %s\n", escapePlantUML(nodeLabel(graph, n.String())), ids[n.String()])
+	}
+	for _, n := range nodes {
+		for _, dep := range graph.GetDependencies(n.String()) {
+			if label := edgeLabel(graph, n.String(), dep.String()); label != "" {
+				w.printf("%s --> %s : %s\n", ids[n.String()], ids[dep.String()], escapePlantUML(label))
+			} else {
+				w.printf("%s --> %s\n", ids[n.String()], ids[dep.String()])
+			}
+		}
+	}
+	w.printf("@enduml\n")
+	return w.err
+}
+
+// nodeLabel returns the "label" attribute of the node with the given name, or its name if it doesn't have one.
+func nodeLabel(graph Interface, name string) string {
+	if attributed, ok := graph.(Attributed); ok {
+		if label, ok := attributed.NodeAttributes(name)["label"]; ok {
+			return label
+		}
+	}
+	return name
+}
+
+// edgeLabel returns the "label" attribute of the edge from source to target, or "" if it doesn't have one.
+func edgeLabel(graph Interface, source, target string) string {
+	if attributed, ok := graph.(Attributed); ok {
+		return attributed.EdgeAttributes(source, target)["label"]
+	}
+	return ""
+}
+
+// identifiers returns a unique identifier for each of the given nodes, consisting only of ASCII letters, digits and
+// underscores, so that it can be used in languages with restricted identifiers. The identifiers are derived from the
+// node names to keep them recognizable and stable across runs.
+func identifiers(nodes []Node) map[string]string {
+	ids := make(map[string]string, len(nodes))
+	used := make(map[string]struct{}, len(nodes))
+	for _, n := range nodes {
+		id := []byte("n_")
+		for _, b := range []byte(n.String()) {
+			if b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' {
+				id = append(id, b)
+			} else {
+				id = append(id, '_')
+			}
+		}
+		unique := string(id)
+		for suffix := 2; ; suffix++ {
+			if _, ok := used[unique]; !ok {
+				break
+			}
+			unique = string(id) + "_" + strconv.Itoa(suffix)
+		}
+		used[unique] = struct{}{}
+		ids[n.String()] = unique
+	}
+	return ids
+}
+
+// escapeMermaid escapes s for use in a quoted Mermaid label using Mermaid's entity codes.
+func escapeMermaid(s string) string {
+	return strings.NewReplacer("#", "#35;", "\"", "#quot;", "<", "#lt;", ">", "#gt;", "\n", "<br>").Replace(s)
+}
+
+// escapePlantUML escapes s for use in a quoted PlantUML label using PlantUML's unicode escapes.
+func escapePlantUML(s string) string {
+	return strings.NewReplacer("\"", "<U+0022>", "\\", "<U+005C>", "\n", "\\n").Replace(s)
 }
@@ -0,0 +1,719 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package graph
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"github.com/SimplicityApks/depgrapher/syntax"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// assertSameGraph fails the test if got doesn't contain exactly the nodes and edges of expected.
+func assertSameGraph(t *testing.T, expected, got Interface) {
+	t.Helper()
+	if len(expected.GetNodes()) != len(got.GetNodes()) {
+		t.Errorf("graph contained %d nodes instead of %d", len(got.GetNodes()), len(expected.GetNodes()))
+	}
+	for _, n := range expected.GetNodes() {
+		if got.GetNode(n.String()) == nil {
+			t.Errorf("graph didn't contain node %q", n.String())
+			continue
+		}
+		if len(expected.GetDependencies(n.String())) != len(got.GetDependencies(n.String())) {
+			t.Errorf("graph contained unexpected dependencies for node %q", n.String())
+		}
+		for _, dep := range expected.GetDependencies(n.String()) {
+			if !got.HasEdge(n.String(), dep.String()) {
+				t.Errorf("graph didn't contain edge %q=>%q", n.String(), dep.String())
+			}
+		}
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	g := setupLevelGraph(TEST_GRAPH_LEVELS)
+	g.AddNodes(intnode(8))
+	g.SetNodeAttribute("1", "label", "the \"root\"")
+	g.SetEdgeAttribute("1", "2", "style", "dashed")
+	var buffer bytes.Buffer
+	if err := WriteJSON(g, &buffer); err != nil {
+		t.Fatal(err)
+	}
+	result, err := New().ReadJSON(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameGraph(t, g, result)
+	if result.NodeAttributes("1")["label"] != "the \"root\"" || result.EdgeAttributes("1", "2")["style"] != "dashed" {
+		t.Error("ReadJSON didn't read the attributes written by WriteJSON")
+	}
+	for i := 2; i <= 8; i++ {
+		if result.NodeAttributes(strconv.Itoa(i)) != nil {
+			t.Errorf("ReadJSON added attributes to node %d", i)
+		}
+	}
+}
+
+func TestGraph_ReadJSON(t *testing.T) {
+	g, err := New().ReadJSON(strings.NewReader(`{"edges": [{"source": "a", "target": "b"}]}`))
+	if err != nil || !g.HasEdge("a", "b") || len(g.GetNodes()) != 2 {
+		t.Error("ReadJSON didn't add the nodes of an edge")
+	}
+	if _, err := New().ReadJSON(strings.NewReader(`{"nodes": [{"attributes": {}}]}`)); err == nil {
+		t.Error("ReadJSON didn't return an error for a node without id")
+	}
+	if _, err := New().ReadJSON(strings.NewReader(`{"nodes": [`)); err == nil {
+		t.Error("ReadJSON didn't return an error for invalid JSON")
+	}
+}
+
+// xmlElements parses the XML document and returns the attributes of each element with the given name.
+func xmlElements(t *testing.T, document []byte, name string) []map[string]string {
+	t.Helper()
+	var result []map[string]string
+	decoder := xml.NewDecoder(bytes.NewReader(document))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return result
+		} else if err != nil {
+			t.Fatalf("invalid XML document: %v\n%s", err, document)
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local == name {
+			attrs := map[string]string{}
+			for _, attr := range start.Attr {
+				attrs[attr.Name.Local] = attr.Value
+			}
+			result = append(result, attrs)
+		}
+	}
+}
+
+func TestWriteGraphML(t *testing.T) {
+	g := setupLevelGraph(TEST_GRAPH_LEVELS)
+	g.AddEdgeAndNodes(intnode(1), NewNode("<a & \"b\">"))
+	g.SetNodeAttribute("1", "label", "root")
+	g.SetEdgeAttribute("1", "2", "weight", "3")
+	var buffer bytes.Buffer
+	if err := WriteGraphML(g, &buffer); err != nil {
+		t.Fatal(err)
+	}
+	if nodes := xmlElements(t, buffer.Bytes(), "node"); len(nodes) != 8 {
+		t.Errorf("WriteGraphML wrote %d nodes instead of 8", len(nodes))
+	}
+	edges := xmlElements(t, buffer.Bytes(), "edge")
+	if len(edges) != 11 {
+		t.Errorf("WriteGraphML wrote %d edges instead of 11", len(edges))
+	}
+	found := false
+	for _, e := range edges {
+		found = found || e["source"] == "1" && e["target"] == "<a & \"b\">"
+	}
+	if !found {
+		t.Error("WriteGraphML didn't escape the node name")
+	}
+	if keys := xmlElements(t, buffer.Bytes(), "key"); len(keys) != 2 {
+		t.Errorf("WriteGraphML declared %d keys instead of 2", len(keys))
+	}
+	if data := xmlElements(t, buffer.Bytes(), "data"); len(data) != 2 {
+		t.Errorf("WriteGraphML wrote %d data elements instead of 2", len(data))
+	}
+}
+
+func TestWriteGEXF(t *testing.T) {
+	g := setupLevelGraph(TEST_GRAPH_LEVELS)
+	g.SetNodeAttribute("1", "label", "root")
+	g.SetNodeAttribute("1", "color", "red")
+	var buffer bytes.Buffer
+	if err := WriteGEXF(g, &buffer); err != nil {
+		t.Fatal(err)
+	}
+	nodes := xmlElements(t, buffer.Bytes(), "node")
+	if len(nodes) != 7 {
+		t.Errorf("WriteGEXF wrote %d nodes instead of 7", len(nodes))
+	}
+	for _, n := range nodes {
+		if n["id"] == "1" && n["label"] != "root" || n["id"] != "1" && n["label"] != n["id"] {
+			t.Errorf("WriteGEXF wrote wrong label %q for node %q", n["label"], n["id"])
+		}
+	}
+	if edges := xmlElements(t, buffer.Bytes(), "edge"); len(edges) != 10 {
+		t.Errorf("WriteGEXF wrote %d edges instead of 10", len(edges))
+	}
+	if attributes := xmlElements(t, buffer.Bytes(), "attribute"); len(attributes) != 1 || attributes[0]["title"] != "color" {
+		t.Errorf("WriteGEXF declared wrong attributes: %v", attributes)
+	}
+}
+
+func TestWriteGraphML_edgeIDs(t *testing.T) {
+	g := New()
+	g.AddEdgeAndNodes(NewNode("a->b"), NewNode("c"))
+	g.AddEdgeAndNodes(NewNode("a"), NewNode("b->c"))
+	g.AddEdgeAndNodes(NewNode(`a\`), NewNode("->c"))
+	for name, write := range map[string]func(Interface, io.Writer) error{"WriteGraphML": WriteGraphML, "WriteGEXF": WriteGEXF} {
+		var buffer bytes.Buffer
+		if err := write(g, &buffer); err != nil {
+			t.Fatal(err)
+		}
+		ids := map[string]bool{}
+		for _, e := range xmlElements(t, buffer.Bytes(), "edge") {
+			ids[e["id"]] = true
+		}
+		if len(ids) != 3 || !ids[`a\->b->c`] || !ids[`a->b\->c`] {
+			t.Errorf("%s wrote the edge ids %v", name, ids)
+		}
+	}
+}
+
+func TestWriteMermaid(t *testing.T) {
+	g := New()
+	g.AddEdgeAndNodes(NewNode("lib/a.o"), NewNode("lib/a#\"1\".c"))
+	g.AddEdgeAndNodes(NewNode("main"), NewNode("end"))
+	g.AddNodes(NewNode("lib/a.c"), NewNode("lib_a.c"))
+	g.SetNodeAttribute("end", "label", "The <End>")
+	var buffer bytes.Buffer
+	if err := WriteMermaid(g, &buffer); err != nil {
+		t.Fatal(err)
+	}
+	output := buffer.String()
+	if !strings.HasPrefix(output, "flowchart TD\n") {
+		t.Error("WriteMermaid didn't start with the flowchart declaration")
+	}
+	for _, line := range []string{
+		"    n_lib_a__1__c[\"lib/a#35;#quot;1#quot;.c\"]\n",
+		"    n_end[\"The #lt;End#gt;\"]\n",
+		"    n_lib_a_o --> n_lib_a__1__c\n",
+		"    n_main --> n_end\n",
+	} {
+		if !strings.Contains(output, line) {
+			t.Errorf("WriteMermaid output didn't contain %q:\n%s", line, output)
+		}
+	}
+	// lib/a.c and lib_a.c share the same sanitized identifier
+	if !strings.Contains(output, "n_lib_a_c[") || !strings.Contains(output, "n_lib_a_c_2[") {
+		t.Errorf("WriteMermaid didn't make the identifiers unique:\n%s", output)
+	}
+}
+
+func TestWritePlantUML(t *testing.T) {
+	g := New()
+	g.AddEdgeAndNodes(NewNode("C:\\out\\\"a\".exe"), NewNode("b"))
+	g.SetNodeAttribute("b", "label", "B")
+	var buffer bytes.Buffer
+	if err := WritePlantUML(g, &buffer); err != nil {
+		t.Fatal(err)
+	}
+	output := buffer.String()
+	if !strings.HasPrefix(output, "@startuml\n") || !strings.HasSuffix(output, "@enduml\n") {
+		t.Errorf("WritePlantUML didn't write the start and end tags:\n%s", output)
+	}
+	for _, line := range []string{
+		"rectangle \"C:<U+005C>out<U+005C><U+0022>a<U+0022>.exe\" as n_C__out__a__exe\n",
+		"rectangle \"B\" as n_b\n",
+		"n_C__out__a__exe --> n_b\n",
+	} {
+		if !strings.Contains(output, line) {
+			t.Errorf("WritePlantUML output didn't contain %q:\n%s", line, output)
+		}
+	}
+}
+
+// outputFunctions are all output functions whose output must be deterministic.
+var outputFunctions = map[string]func(Interface, io.Writer) error{
+	"WriteDot": WriteDot,
+	"WriteGraph": func(g Interface, w io.Writer) error {
+		return WriteGraph(g, w, syntax.Makefile)
+	},
+	"String": func(g Interface, w io.Writer) error {
+		_, err := io.WriteString(w, g.(fmt.Stringer).String())
+		return err
+	},
+	"RenderTree": func(g Interface, w io.Writer) error {
+		return RenderTree(w, g, TreeOptions{})
+	},
+	"WriteJSON":    WriteJSON,
+	"WriteGraphML": WriteGraphML,
+	"WriteGEXF":    WriteGEXF,
+	"WriteMakefile": func(g Interface, w io.Writer) error {
+		return WriteMakefile(g, w, MakefileOptions{Width: 40, Phony: true})
+	},
+	"WriteHTML":     WriteHTML,
+	"WriteMermaid":  WriteMermaid,
+	"WritePlantUML": WritePlantUML,
+	"WriteSVG":      WriteSVG,
+}
+
+func TestOutput_deterministic(t *testing.T) {
+	const makefile = "all: build install test\nbuild: prepare compile pack\ntest: build compile\ninstall: pack\n"
+	for name, write := range outputFunctions {
+		for _, order := range []Order{DeclarationOrder, NameOrder} {
+			var expected string
+			// map iteration order is randomized, so a few runs are very likely to expose a dependence on it
+			for run := 0; run < 20; run++ {
+				g, err := New().FromScanner(bufio.NewScanner(strings.NewReader(makefile)), syntax.Makefile)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var buffer bytes.Buffer
+				if err := write(Sorted(g, order), &buffer); err != nil {
+					t.Fatal(err)
+				}
+				if run == 0 {
+					expected = buffer.String()
+				} else if buffer.String() != expected {
+					t.Errorf("%s output differed between runs in order %d:\n%s\n%s", name, order, expected, buffer.String())
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestSorted(t *testing.T) {
+	g, _ := New().FromScanner(bufio.NewScanner(strings.NewReader("b: d c\na: c\n")), syntax.Makefile)
+	g.SetNodeAttribute("c", "label", "C")
+	expected := map[Order]string{
+		DeclarationOrder: "b => d; b => c; a => c; ",
+		NameOrder:        "a => c; b => c; b => d; ",
+	}
+	for order, str := range expected {
+		sorted := Sorted(g, order)
+		if sorted.String() != str {
+			t.Errorf("Sorted in order %d returned %q instead of %q", order, sorted.String(), str)
+		}
+		if sorted.NodeAttributes("c")["label"] != "C" {
+			t.Error("Sorted didn't copy the attributes")
+		}
+	}
+	var buffer bytes.Buffer
+	WriteDot(Sorted(g, NameOrder), &buffer)
+	if buffer.String() != "digraph{\n\"a\"->\"c\";\n\"b\"->\"c\";\n\"b\"->\"d\";\n}" {
+		t.Errorf("WriteDot didn't write the sorted graph in order:\n%s", buffer.String())
+	}
+}
+
+func TestWriteGraph_roundTrip(t *testing.T) {
+	names := []string{"all", "with space", " leading and trailing ", "quote\"d", "back\\slash", "trailing\\",
+		"new\nline", "colon:", "#comment", "$(VAR)", "a->b", "semi;colon", "}", "digraph{", "tab\tbed", "ünicode",
+		`C:\\new\\x.c`}
+	for name, s := range map[string]*syntax.Syntax{"Makefile": syntax.Makefile, "Dot": syntax.Dot} {
+		names := names
+		if s == syntax.Makefile {
+			// Makefiles can't contain names with newlines
+			names = append(names[:6:6], names[7:]...)
+		}
+		g := New()
+		for i := 1; i < len(names); i++ {
+			g.AddEdgeAndNodes(NewNode(names[0]), NewNode(names[i]))
+			g.AddEdgeAndNodes(NewNode(names[i]), NewNode(names[(i*7)%len(names)]))
+		}
+		g.AddNodes(NewNode("isolated \"node\""))
+		var buffer bytes.Buffer
+		WriteGraph(g, &buffer, s)
+		result, err := New().FromScanner(bufio.NewScanner(strings.NewReader(buffer.String())), s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(name, func(t *testing.T) { assertSameGraph(t, g, result) })
+		synced, err := NewSynced().FromScanner(bufio.NewScanner(strings.NewReader(buffer.String())), s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(name+"Synced", func(t *testing.T) { assertSameGraph(t, g, synced) })
+		// the output must also be stable when written again
+		var again bytes.Buffer
+		WriteGraph(result, &again, s)
+		if again.String() != buffer.String() {
+			t.Errorf("WriteGraph output changed after a round trip with %s:\n%s\n%s", name, buffer.String(), again.String())
+		}
+	}
+}
+
+func TestGraph_FromScanner_quoted(t *testing.T) {
+	g, err := New().FromScanner(bufio.NewScanner(strings.NewReader(
+		"digraph{\n\"a b\" -> \"c;d\" ;\ne->\"f\\\"g\";\n\"lonely\";\nnode [shape=box];\n}\nfoo\\ bar: baz\\:qux $$x\nclean:\n"+
+			`out\new.o: src\new.c C:\\dir\x\ y.c`+"\n")),
+		syntax.Dot, syntax.Makefile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range [][2]string{{"a b", "c;d"}, {"e", "f\"g"}, {"foo bar", "baz:qux"}, {"foo bar", "$x"},
+		{`out\new.o`, `src\new.c`}, {`out\new.o`, `C:\dir\x y.c`}} {
+		if !g.HasEdge(e[0], e[1]) {
+			t.Errorf("FromScanner didn't read edge %q=>%q: %v", e[0], e[1], g)
+		}
+	}
+	for _, name := range []string{"lonely", "clean"} {
+		if g.GetNode(name) == nil {
+			t.Errorf("FromScanner didn't read node %q without edges", name)
+		}
+	}
+	if len(g.GetNodes()) != 12 {
+		t.Errorf("FromScanner read %d nodes instead of 12: %v", len(g.GetNodes()), g.GetNodes())
+	}
+}
+
+// failingWriter is an io.Writer that fails after writing limit bytes.
+type failingWriter struct {
+	limit int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		n := w.limit
+		w.limit = 0
+		return n, io.ErrShortWrite
+	}
+	w.limit -= len(p)
+	return len(p), nil
+}
+
+func TestOutput_errors(t *testing.T) {
+	g := setupLevelGraph(TEST_GRAPH_LEVELS)
+	for name, write := range outputFunctions {
+		if name == "String" {
+			continue
+		}
+		for _, limit := range []int{0, 10} {
+			if err := write(g, &failingWriter{limit: limit}); err == nil {
+				t.Errorf("%s didn't return an error for a failing writer after %d bytes", name, limit)
+			}
+		}
+	}
+	if err := PrintDepTree(g, nil); err == nil {
+		t.Error("PrintDepTree didn't return an error for a nil start node")
+	}
+}
+
+func TestWrapLines(t *testing.T) {
+	lines := []string{"0123456789", "abcdefghij"}
+	out := wrapLines([]*string{&lines[0], &lines[1]}, 10, 4)
+	var result []string
+	for _, line := range out {
+		result = append(result, *line)
+	}
+	expected := "0123|abcd||4567|efgh||89|ij"
+	if strings.Join(result, "|") != expected {
+		t.Errorf("wrapLines returned %q instead of %q", strings.Join(result, "|"), expected)
+	}
+	if out := wrapLines([]*string{&lines[0]}, 10, 0); len(out) != 1 || *out[0] != lines[0] {
+		t.Error("wrapLines wrapped the lines for an unlimited width")
+	}
+}
+
+func TestRenderTree(t *testing.T) {
+	g, _ := New().FromScanner(bufio.NewScanner(strings.NewReader("all: build install test\nbuild: prepare compile pack\n")), syntax.Makefile)
+	expected := `                  all
+              /           \       \
+             V             V       V
+         build           install  test
+      /      |     \
+     V       V      V
+ prepare  compile  pack
+`
+	var buffer bytes.Buffer
+	if err := RenderTree(&buffer, g, TreeOptions{Root: "all"}); err != nil {
+		t.Fatal(err)
+	}
+	if buffer.String() != expected {
+		t.Errorf("RenderTree returned\n%s\ninstead of\n%s", buffer.String(), expected)
+	}
+	if err := RenderTree(&buffer, g, TreeOptions{Root: "nonexistent"}); err == nil {
+		t.Error("RenderTree didn't return an error for a missing root")
+	}
+	// a repeated node with a custom marker
+	g.AddEdgeAndNodes(NewNode("install"), NewNode("pack"))
+	buffer.Reset()
+	if err := RenderTree(&buffer, g, TreeOptions{Root: "all", RepeatedMarker: "*"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buffer.String(), " *pack") {
+		t.Errorf("RenderTree didn't mark the repeated node:\n%s", buffer.String())
+	}
+	// nodes only reachable through a cycle must be rendered as well
+	g.AddEdgeAndNodes(NewNode("cycle1"), NewNode("cycle2"))
+	g.AddEdgeAndNodes(NewNode("cycle2"), NewNode("cycle1"))
+	buffer.Reset()
+	if err := RenderTree(&buffer, g, TreeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buffer.String(), " cycle1") || !strings.Contains(buffer.String(), " &cycle1") {
+		t.Errorf("RenderTree didn't render the cycle:\n%s", buffer.String())
+	}
+	buffer.Reset()
+	if err := RenderTree(&buffer, New(), TreeOptions{}); err != nil || buffer.String() != "{empty graph}\n" {
+		t.Errorf("RenderTree returned %q for an empty graph", buffer.String())
+	}
+}
+
+func TestRenderTree_concurrent(t *testing.T) {
+	g := setupLevelGraph(5)
+	var expected bytes.Buffer
+	if err := RenderTree(&expected, g, TreeOptions{Width: 60}); err != nil {
+		t.Fatal(err)
+	}
+	results := make(chan string)
+	for i := 0; i < 8; i++ {
+		go func() {
+			var buffer bytes.Buffer
+			RenderTree(&buffer, g, TreeOptions{Width: 60})
+			results <- buffer.String()
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		if result := <-results; result != expected.String() {
+			t.Errorf("concurrent RenderTree returned different output:\n%s\n%s", result, expected.String())
+		}
+	}
+}
+
+func TestRenderTree_indented(t *testing.T) {
+	g, _ := New().FromScanner(bufio.NewScanner(strings.NewReader(
+		"all: build install\nbuild: prepare pack\ninstall: pack\npack: tar\n")), syntax.Makefile)
+	tests := []struct {
+		name     string
+		opts     TreeOptions
+		expected string
+	}{
+		{"tree", TreeOptions{Style: IndentStyle}, `all
+├── build
+│   ├── prepare
+│   └── pack
+│       └── tar
+└── install
+    └── pack (*)
+`},
+		{"npm", TreeOptions{Style: NpmStyle}, `all
+├─┬ build
+│ ├── prepare
+│ └─┬ pack
+│   └── tar
+└─┬ install
+  └── pack deduped
+`},
+		{"depth", TreeOptions{Style: IndentStyle, Root: "build", MaxDepth: 1}, `build
+├── prepare
+└── pack
+`},
+	}
+	for _, test := range tests {
+		var buffer bytes.Buffer
+		if err := RenderTree(&buffer, g, test.opts); err != nil {
+			t.Fatal(err)
+		}
+		if buffer.String() != test.expected {
+			t.Errorf("%s: RenderTree returned\n%s\ninstead of\n%s", test.name, buffer.String(), test.expected)
+		}
+	}
+	g.AddEdge("tar", "build")
+	g.SetNodeAttribute("install", "phony", "true")
+	var buffer bytes.Buffer
+	if err := RenderTree(&buffer, g, TreeOptions{Style: IndentStyle, Root: "all", Color: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, colored := range []string{ansiRed + "build" + ansiReset, ansiRed + "tar" + ansiReset,
+		ansiCyan + "install" + ansiReset, "── prepare\n"} {
+		if !strings.Contains(buffer.String(), colored) {
+			t.Errorf("RenderTree with Color doesn't contain %q:\n%s", colored, buffer.String())
+		}
+	}
+}
+
+func TestCycles(t *testing.T) {
+	g, _ := New().FromScanner(bufio.NewScanner(strings.NewReader(
+		"a: b\nb: c\nc: a d\nd: e\ne: e\nf: a\n")), syntax.Makefile)
+	expected := "[[e] [a b c]]"
+	if cycles := fmt.Sprint(Cycles(g)); cycles != expected {
+		t.Errorf("Cycles returned %s instead of %s", cycles, expected)
+	}
+	components := StronglyConnectedComponents(g)
+	if len(components) != 4 || fmt.Sprint(components[len(components)-1]) != "[f]" {
+		t.Errorf("StronglyConnectedComponents returned %v", components)
+	}
+	if cycles := Cycles(setupLevelGraph(4)); len(cycles) != 0 {
+		t.Errorf("Cycles returned %v for an acyclic graph", cycles)
+	}
+}
+
+func TestGraph_MarkPhony(t *testing.T) {
+	g, _ := New().FromScanner(bufio.NewScanner(strings.NewReader(".PHONY: all clean\nall: main\n")), syntax.Makefile)
+	if !IsPhony(g, "all") || IsPhony(g, "main") {
+		t.Error("IsPhony didn't detect the .PHONY edge")
+	}
+	g.MarkPhony()
+	if g.GetNode(".PHONY") != nil {
+		t.Error("MarkPhony didn't remove .PHONY")
+	}
+	if !IsPhony(g, "all") || !IsPhony(g, "clean") || IsPhony(g, "main") {
+		t.Error("MarkPhony didn't set the phony attribute")
+	}
+}
+
+func TestWriteDotOptions(t *testing.T) {
+	g, _ := New().FromScanner(bufio.NewScanner(strings.NewReader(
+		".PHONY: all\nall: src/main.o src/util.o | out\nsrc/main.o: src/main.c include/util.h\n\tcc -c $<\n"+
+			"src/util.o: include/util.h\n")), syntax.Makefile)
+	g.MarkPhony()
+	g.SetNodeAttribute("src/main.c", "color", "blue")
+	var expected, buffer bytes.Buffer
+	WriteDot(g, &expected)
+	if err := WriteDotOptions(g, &buffer, DotOptions{}); err != nil || buffer.String() != expected.String() {
+		t.Errorf("WriteDotOptions with the zero value returned\n%s\ninstead of\n%s", buffer.String(), expected.String())
+	}
+	opts := DotOptions{
+		RankDir:         "LR",
+		GraphAttributes: map[string]string{"splines": "ortho"},
+		Cluster:         ClusterByDirectory,
+		Rules: []DotRule{
+			{Phony: true, Attributes: map[string]string{"shape": "box"}},
+			{Pattern: "*/*.h", Attributes: map[string]string{"color": "grey"}},
+			{Pattern: "*.c", Attributes: map[string]string{"color": "grey"}},
+		},
+		Highlight: "src/util.o",
+	}
+	buffer.Reset()
+	if err := WriteDotOptions(g, &buffer, opts); err != nil {
+		t.Fatal(err)
+	}
+	expectedDot := `digraph {
+  rankdir="LR";
+  splines="ortho";
+  "all" [shape="box"];
+  "out";
+  subgraph "cluster_src" {
+    label="src";
+    "src/main.o";
+    "src/util.o" [color="red", penwidth="2"];
+    "src/main.c" [color="grey"];
+  }
+  subgraph "cluster_include" {
+    label="include";
+    "include/util.h" [color="red", penwidth="2"];
+  }
+  "all" -> "src/main.o";
+  "all" -> "src/util.o";
+  "all" -> "out" [style="dashed"];
+  "src/main.o" -> "src/main.c";
+  "src/main.o" -> "include/util.h";
+  "src/util.o" -> "include/util.h" [color="red", penwidth="2"];
+}
+`
+	if buffer.String() != expectedDot {
+		t.Errorf("WriteDotOptions returned\n%s\ninstead of\n%s", buffer.String(), expectedDot)
+	}
+	if cluster := ClusterByPrefix(2)("a/b/c/d"); cluster != "a/b" {
+		t.Errorf("ClusterByPrefix(2) returned %q instead of a/b", cluster)
+	}
+	if cluster := ClusterByPrefix(2)("a/b"); cluster != "" {
+		t.Errorf("ClusterByPrefix(2) clustered a/b into %q", cluster)
+	}
+}
+
+func TestWriteMakefile(t *testing.T) {
+	const makefile = ".PHONY: all clean\nall: main | out\\ dir\nmain: main.o util.o lib/a$$b.o lib/long-name.o lib/other.o\nclean:\n"
+	g, _ := New().FromScanner(bufio.NewScanner(strings.NewReader(makefile)), syntax.Makefile)
+	g.MarkPhony()
+	if g.EdgeAttributes("all", "out dir")["order-only"] != "true" || g.EdgeAttributes("all", "main")["order-only"] != "" {
+		t.Fatalf("FromScanner didn't read the order-only prerequisite: %v", g)
+	}
+	var buffer bytes.Buffer
+	if err := WriteMakefile(g, &buffer, MakefileOptions{Width: 40, Phony: true}); err != nil {
+		t.Fatal(err)
+	}
+	expected := `.PHONY: all clean
+all: main | out\ dir
+clean:
+main: main.o util.o lib/a$$b.o \
+    lib/long-name.o lib/other.o
+`
+	if buffer.String() != expected {
+		t.Errorf("WriteMakefile returned\n%s\ninstead of\n%s", buffer.String(), expected)
+	}
+	read, _ := New().FromScanner(bufio.NewScanner(&buffer), syntax.Makefile)
+	read.MarkPhony()
+	assertSameGraph(t, g, read)
+	if read.EdgeAttributes("all", "out dir")["order-only"] != "true" || !IsPhony(read, "clean") {
+		t.Errorf("WriteMakefile didn't preserve the order-only prerequisite and phony targets: %v", read)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	g, _ := New().FromScanner(bufio.NewScanner(strings.NewReader("all: build test,1\nbuild: compile\ntest,1: compile\n")),
+		syntax.Makefile)
+	tests := []struct {
+		name     string
+		write    func(Interface, io.Writer) error
+		expected string
+	}{
+		{"WriteCSV", WriteCSV, "source,target\nall,build\nall,\"test,1\"\nbuild,compile\n\"test,1\",compile\n"},
+		{"WriteMatrix", WriteMatrix, ",all,build,\"test,1\",compile\nall,0,1,1,0\nbuild,0,0,0,1\n\"test,1\",0,0,0,1\n" +
+			"compile,0,0,0,0\n"},
+		{"WriteNodeTable", WriteNodeTable, "node,in_degree,out_degree,transitive_dependencies,transitive_dependants\n" +
+			"all,0,2,3,0\nbuild,1,1,1,1\n\"test,1\",1,1,1,1\ncompile,2,0,0,3\n"},
+	}
+	for _, test := range tests {
+		var buffer bytes.Buffer
+		if err := test.write(g, &buffer); err != nil {
+			t.Fatal(err)
+		}
+		if buffer.String() != test.expected {
+			t.Errorf("%s returned\n%s\ninstead of\n%s", test.name, buffer.String(), test.expected)
+		}
+	}
+}
+
+func TestSorted_topological(t *testing.T) {
+	g, _ := New().FromScanner(bufio.NewScanner(strings.NewReader("all: build test\ntest: build\nbuild: compile\n")),
+		syntax.Makefile)
+	if nodes := fmt.Sprint(Sorted(g, TopologicalOrder).GetNodes()); nodes != "[compile build test all]" {
+		t.Errorf("Sorted with TopologicalOrder returned %s", nodes)
+	}
+}
+
+func TestClosures(t *testing.T) {
+	g, _ := New().FromScanner(bufio.NewScanner(strings.NewReader(
+		"all: build test\ntest: build\nbuild: compile\ncompile: compile\nother: compile\n")), syntax.Makefile)
+	g.SetEdgeAttribute("test", "build", "label", "needs")
+	if nodes := fmt.Sprint(DependencyClosure(g, "test", "missing")); nodes != "[build test compile]" {
+		t.Errorf("DependencyClosure returned %s", nodes)
+	}
+	if nodes := fmt.Sprint(DependantClosure(g, "build")); nodes != "[all build test]" {
+		t.Errorf("DependantClosure returned %s", nodes)
+	}
+	if nodes := fmt.Sprint(Affected(g, []string{"build", "missing"}, nil)); nodes != "[all build test]" {
+		t.Errorf("Affected returned %s", nodes)
+	}
+	roots := func(name string) bool { return len(g.GetDependants(name)) == 0 }
+	if nodes := fmt.Sprint(Affected(g, []string{"compile"}, roots)); nodes != "[all other]" {
+		t.Errorf("Affected returned %s for the roots", nodes)
+	}
+	if nodes := Affected(g, []string{"missing"}, nil); len(nodes) != 0 {
+		t.Errorf("Affected returned %s for an unknown node", nodes)
+	}
+	sub := Subgraph(g, DependantClosure(g, "build"))
+	if sub.String() != "all => build; all => test; test => build; " || sub.EdgeAttributes("test", "build")["label"] != "needs" {
+		t.Errorf("Subgraph returned\n%s", sub)
+	}
+	paths := []struct {
+		source, target, expected string
+	}{
+		{"all", "compile", "[all build compile]"},
+		{"compile", "compile", "[compile compile]"},
+		{"all", "all", "[]"},
+		{"compile", "all", "[]"},
+		{"missing", "all", "[]"},
+	}
+	for _, path := range paths {
+		if result := fmt.Sprint(ShortestPath(g, path.source, path.target)); result != path.expected {
+			t.Errorf("ShortestPath(%s, %s) returned %s instead of %s", path.source, path.target, result, path.expected)
+		}
+	}
+}
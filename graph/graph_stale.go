@@ -0,0 +1,149 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Contains the detection of out of date targets from the modification times of their files, like make.
+package graph
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// StaleReason is the reason why a target is stale.
+type StaleReason string
+
+const (
+	// StaleMissing means that the file of the target doesn't exist
+	StaleMissing StaleReason = "missing"
+	// StaleNewer means that the files of prerequisites were modified after the file of the target
+	StaleNewer StaleReason = "newer"
+	// StaleOutdated means that prerequisites are stale or phony themselves, so they will be rebuilt before the target
+	StaleOutdated StaleReason = "outdated"
+)
+
+// StaleTarget is a target that is out of date, see FindStale.
+type StaleTarget struct {
+	Name   string      `json:"name"`
+	Reason StaleReason `json:"reason"`
+	// Prerequisites are the prerequisites causing the Reason, in the order of GetDependencies
+	Prerequisites []string `json:"prerequisites,omitempty"`
+}
+
+// StaleResult is the result of FindStale.
+type StaleResult struct {
+	// Stale contains the stale targets in the order of GetNodes
+	Stale []StaleTarget `json:"stale"`
+	// Missing contains the nodes in the order of GetNodes that aren't targets and whose files don't exist, so they
+	// can't be built
+	Missing []string `json:"missing"`
+}
+
+// FileModTime returns a function for FindStale that returns the modification times of the files of the nodes,
+// treating the names of the nodes as paths relative to dir.
+func FileModTime(dir string) func(name string) (time.Time, bool) {
+	return func(name string) (time.Time, bool) {
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(dir, name)
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return info.ModTime(), true
+	}
+}
+
+// FindStale returns the targets of graph that are out of date in the same way make decides what to rebuild, using
+// modTime to get the modification time of the file of a node and whether it exists. A target is a node with
+// dependencies or a recipe, see FromScanner. It is stale if its file doesn't exist, else if the files of prerequisites
+// are newer, else if prerequisites are stale or phony themselves. Order-only prerequisites are ignored, as they don't
+// cause a rebuild. Phony targets are always rebuilt and therefore not reported as stale. Like make drops circular
+// dependencies, the edges of a cycle to nodes that come later in the topological order are ignored.
+//
+// This operation is dominated by sorting graph topologically with Sorted, which takes time proportional to the product
+// of the number of nodes and the number of edges in graph, O(n*e), plus the cost of a GetDependencies and a modTime call
+// for each node.
+func FindStale(graph Interface, modTime func(name string) (time.Time, bool)) *StaleResult {
+	type file struct {
+		modified time.Time
+		exists   bool
+		// rebuilt is set for the nodes that are stale or phony
+		rebuilt bool
+	}
+	attributed, _ := graph.(Attributed)
+	// files contains the nodes whose dependencies were visited already
+	files := map[string]*file{}
+	stale := map[string]StaleTarget{}
+	for _, n := range Sorted(graph, TopologicalOrder).GetNodes() {
+		name := n.String()
+		if IsPhony(graph, name) {
+			files[name] = &file{rebuilt: true}
+			continue
+		}
+		f := &file{}
+		f.modified, f.exists = modTime(name)
+		files[name] = f
+		dependencies := graph.GetDependencies(name)
+		if len(dependencies) == 0 && (attributed == nil || attributed.NodeAttributes(name)["recipe"] == "") {
+			continue
+		}
+		target := StaleTarget{Name: name}
+		var newer, outdated []string
+		for _, dep := range dependencies {
+			depFile, visited := files[dep.String()]
+			if !visited || attributed != nil && attributed.EdgeAttributes(name, dep.String())["order-only"] == "true" {
+				continue
+			}
+			if depFile.rebuilt {
+				outdated = append(outdated, dep.String())
+			} else if depFile.exists && depFile.modified.After(f.modified) {
+				newer = append(newer, dep.String())
+			}
+		}
+		switch {
+		case !f.exists:
+			target.Reason = StaleMissing
+		case len(newer) > 0:
+			target.Reason, target.Prerequisites = StaleNewer, newer
+		case len(outdated) > 0:
+			target.Reason, target.Prerequisites = StaleOutdated, outdated
+		default:
+			continue
+		}
+		f.rebuilt = true
+		stale[name] = target
+	}
+	result := &StaleResult{Stale: []StaleTarget{}, Missing: []string{}}
+	for _, n := range graph.GetNodes() {
+		name := n.String()
+		if target, ok := stale[name]; ok {
+			result.Stale = append(result.Stale, target)
+		} else if !files[name].exists && !files[name].rebuilt {
+			result.Missing = append(result.Missing, name)
+		}
+	}
+	return result
+}
+
+// WriteText writes r in a human-readable format to writer, one line per stale target and missing prerequisite.
+func (r *StaleResult) WriteText(writer io.Writer) error {
+	w := &errWriter{w: writer}
+	for _, target := range r.Stale {
+		switch target.Reason {
+		case StaleMissing:
+			w.printf("%s: doesn't exist\n", target.Name)
+		case StaleNewer:
+			w.printf("%s: newer prerequisites %s\n", target.Name, strings.Join(target.Prerequisites, ", "))
+		case StaleOutdated:
+			w.printf("%s: rebuilt prerequisites %s\n", target.Name, strings.Join(target.Prerequisites, ", "))
+		}
+	}
+	for _, name := range r.Missing {
+		w.printf("%s: missing prerequisite\n", name)
+	}
+	return w.err
+}
@@ -0,0 +1,42 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package graph
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/SimplicityApks/depgrapher/syntax"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFindStale(t *testing.T) {
+	g, _ := New().FromScanner(bufio.NewScanner(strings.NewReader(
+		"all: app test.o\napp: main.o util.o\nmain.o: main.c config.h\nutil.o: util.c | objdir\nobjdir:\n\tmkdir $@\n"+
+			"test.o: test.c\n.PHONY: all\n")), syntax.Makefile)
+	g.MarkPhony()
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour)
+	for name, minute := range map[string]int{"main.c": 1, "config.h": 5, "main.o": 3, "util.c": 1, "util.o": 2, "app": 4} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		modified := start.Add(time.Duration(minute) * time.Minute)
+		if err := os.Chtimes(path, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+	result := FindStale(g, FileModTime(dir))
+	expected := `{"stale":[{"name":"app","reason":"outdated","prerequisites":["main.o"]},` +
+		`{"name":"test.o","reason":"missing"},{"name":"main.o","reason":"newer","prerequisites":["config.h"]},` +
+		`{"name":"objdir","reason":"missing"}],"missing":["test.c"]}`
+	if data, _ := json.Marshal(result); string(data) != expected {
+		t.Errorf("FindStale returned\n%s", data)
+	}
+}
@@ -0,0 +1,163 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Contains statistics to track the health of a dependency graph.
+package graph
+
+import (
+	"io"
+	"sort"
+)
+
+// Statistics summarizes the structure of a graph, see Stats. The JSON encoding of Statistics is stable, so it can be
+// stored to track a graph over time.
+type Statistics struct {
+	Nodes int `json:"nodes"`
+	Edges int `json:"edges"`
+	// Roots are the nodes without dependants, Leaves the nodes without dependencies, in the order of GetNodes
+	Roots  []string `json:"roots"`
+	Leaves []string `json:"leaves"`
+	// MaxDepth is the number of edges of the longest chain of dependencies, not counting edges within cycles
+	MaxDepth int `json:"max_depth"`
+	// FanIn and FanOut count the nodes with each number of dependants and dependencies, sorted by Degree
+	FanIn  []DegreeCount `json:"fan_in"`
+	FanOut []DegreeCount `json:"fan_out"`
+	// MostDependedOn ranks the nodes by their number of direct dependants
+	MostDependedOn []NodeCount `json:"most_depended_on"`
+	// MostDependants ranks the nodes by their number of direct and indirect dependants, i.e. the number of nodes that
+	// need to be rebuilt if they change
+	MostDependants []NodeCount `json:"most_dependants"`
+	// Cycles is the number of dependency cycles, see Cycles
+	Cycles int `json:"cycles"`
+}
+
+// DegreeCount is the number of nodes with a degree.
+type DegreeCount struct {
+	Degree int `json:"degree"`
+	Nodes  int `json:"nodes"`
+}
+
+// NodeCount is a node with a count, e.g. of its dependants.
+type NodeCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Stats returns the statistics of graph. The rankings contain all nodes with a count greater than zero, sorted by
+// their count in descending order and then by the order of GetNodes, use Statistics.Limit to only keep the top nodes.
+//
+// This operation calls GetDependencies and GetDependants once for each node of graph, plus the calls of
+// StronglyConnectedComponents to find the cycles, and then takes time proportional to the product of the number of
+// nodes and the sum of the number of nodes and the number of edges in graph, O(n*(n+e)), for the transitive dependants.
+func Stats(graph Interface) *Statistics {
+	stats := &Statistics{
+		Roots:          []string{},
+		Leaves:         []string{},
+		MostDependedOn: []NodeCount{},
+		MostDependants: []NodeCount{},
+	}
+	allDependencies, allDependants := adjacency(graph, graph.GetDependencies), adjacency(graph, graph.GetDependants)
+	fanIn, fanOut := map[int]int{}, map[int]int{}
+	for _, n := range graph.GetNodes() {
+		name := n.String()
+		dependants, dependencies := len(allDependants[name]), len(allDependencies[name])
+		stats.Nodes++
+		stats.Edges += dependencies
+		if dependants == 0 {
+			stats.Roots = append(stats.Roots, name)
+		}
+		if dependencies == 0 {
+			stats.Leaves = append(stats.Leaves, name)
+		}
+		fanIn[dependants]++
+		fanOut[dependencies]++
+		if dependants > 0 {
+			stats.MostDependedOn = append(stats.MostDependedOn, NodeCount{name, dependants})
+			transitive := len(closure(func(name string) []Node { return allDependants[name] }, name)) - 1
+			stats.MostDependants = append(stats.MostDependants, NodeCount{name, transitive})
+		}
+	}
+	stats.FanIn, stats.FanOut = degreeCounts(fanIn), degreeCounts(fanOut)
+	sortNodeCounts(stats.MostDependedOn)
+	sortNodeCounts(stats.MostDependants)
+	// the components are sorted with their dependencies first, so the depth of all dependencies is already known
+	components := StronglyConnectedComponents(graph)
+	component := map[string]int{}
+	for i, nodes := range components {
+		for _, n := range nodes {
+			component[n.String()] = i
+		}
+	}
+	depth := make([]int, len(components))
+	for i, nodes := range components {
+		if len(nodes) > 1 || graph.HasEdge(nodes[0].String(), nodes[0].String()) {
+			stats.Cycles++
+		}
+		for _, n := range nodes {
+			for _, dep := range allDependencies[n.String()] {
+				if c := component[dep.String()]; c != i && depth[c]+1 > depth[i] {
+					depth[i] = depth[c] + 1
+				}
+			}
+		}
+		if depth[i] > stats.MaxDepth {
+			stats.MaxDepth = depth[i]
+		}
+	}
+	return stats
+}
+
+// Limit truncates the rankings of s to at most n nodes. A negative n doesn't limit the rankings.
+func (s *Statistics) Limit(n int) {
+	if n < 0 {
+		return
+	}
+	if len(s.MostDependedOn) > n {
+		s.MostDependedOn = s.MostDependedOn[:n]
+	}
+	if len(s.MostDependants) > n {
+		s.MostDependants = s.MostDependants[:n]
+	}
+}
+
+// WriteText writes s in a human-readable format to writer.
+func (s *Statistics) WriteText(writer io.Writer) error {
+	w := &errWriter{w: writer}
+	w.printf("nodes: %d\nedges: %d\nroots: %d\nleaves: %d\nmax depth: %d\ncycles: %d\n", s.Nodes, s.Edges,
+		len(s.Roots), len(s.Leaves), s.MaxDepth, s.Cycles)
+	for _, distribution := range []struct {
+		title  string
+		counts []DegreeCount
+	}{{"fan-in", s.FanIn}, {"fan-out", s.FanOut}} {
+		w.printf("\n%s (degree: nodes):\n", distribution.title)
+		for _, count := range distribution.counts {
+			w.printf("  %d: %d\n", count.Degree, count.Nodes)
+		}
+	}
+	for _, ranking := range []struct {
+		title  string
+		counts []NodeCount
+	}{{"most depended on", s.MostDependedOn}, {"most dependants", s.MostDependants}} {
+		w.printf("\n%s:\n", ranking.title)
+		for _, count := range ranking.counts {
+			w.printf("  %6d  %s\n", count.Count, count.Name)
+		}
+	}
+	return w.err
+}
+
+// degreeCounts returns the given counts of nodes per degree sorted by degree.
+func degreeCounts(counts map[int]int) []DegreeCount {
+	result := make([]DegreeCount, 0, len(counts))
+	for degree, nodes := range counts {
+		result = append(result, DegreeCount{degree, nodes})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Degree < result[j].Degree })
+	return result
+}
+
+// sortNodeCounts sorts counts by their count in descending order, keeping the order of equal counts.
+func sortNodeCounts(counts []NodeCount) {
+	sort.SliceStable(counts, func(i, j int) bool { return counts[i].Count > counts[j].Count })
+}
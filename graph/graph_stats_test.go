@@ -0,0 +1,42 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package graph
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"github.com/SimplicityApks/depgrapher/syntax"
+	"strings"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	g, _ := New().FromScanner(bufio.NewScanner(strings.NewReader(
+		"all: build test\ntest: build\nbuild: compile\ncompile: a b\na: b\nb: a\nother: compile\n")), syntax.Makefile)
+	stats := Stats(g)
+	stats.Limit(2)
+	var buffer bytes.Buffer
+	if err := json.NewEncoder(&buffer).Encode(stats); err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"nodes":7,"edges":9,"roots":["all","other"],"leaves":[],"max_depth":4,` +
+		`"fan_in":[{"degree":0,"nodes":2},{"degree":1,"nodes":1},{"degree":2,"nodes":4}],` +
+		`"fan_out":[{"degree":1,"nodes":5},{"degree":2,"nodes":2}],` +
+		`"most_depended_on":[{"name":"build","count":2},{"name":"compile","count":2}],` +
+		`"most_dependants":[{"name":"a","count":6},{"name":"b","count":6}],"cycles":1}` + "\n"
+	if buffer.String() != expected {
+		t.Errorf("Stats returned\n%s", buffer.String())
+	}
+	stats = Stats(g)
+	stats.Limit(-1)
+	if len(stats.MostDependedOn) != 5 || len(stats.MostDependants) != 5 {
+		t.Errorf("Limit(-1) truncated the rankings to %v and %v", stats.MostDependedOn, stats.MostDependants)
+	}
+	buffer.Reset()
+	if err := Stats(New()).WriteText(&buffer); err != nil || !strings.HasPrefix(buffer.String(), "nodes: 0\nedges: 0\n") {
+		t.Errorf("WriteText wrote\n%s", buffer.String())
+	}
+}
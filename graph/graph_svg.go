@@ -0,0 +1,73 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Contains the SVG writer drawing graphs with the layout engine.
+package graph
+
+import (
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// WriteSVG writes a drawing of the given graph to writer as a standalone SVG image, so no external tools like
+// Graphviz are needed. The graph is laid out by NewLayout with the default options, dependants above their
+// dependencies. Nodes are labelled with their "label" attribute, or their name if they don't have one, and show their
+// name as a tooltip.
+func WriteSVG(graph Interface, writer io.Writer) error {
+	layout := NewLayout(graph, LayoutOptions{})
+	w := &errWriter{w: writer}
+	w.printf("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	w.printf("<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%s\" height=\"%s\" viewBox=\"0 0 %s %s\" "+
+		"font-family=\"sans-serif\" font-size=\"12\">\n", svgNumber(layout.Width), svgNumber(layout.Height),
+		svgNumber(layout.Width), svgNumber(layout.Height))
+	w.printf("  <defs>\n    <marker id=\"arrow\" viewBox=\"0 0 10 10\" refX=\"10\" refY=\"5\" markerWidth=\"8\" " +
+		"markerHeight=\"8\" orient=\"auto\">\n      <path d=\"M 0 0 L 10 5 L 0 10 z\" fill=\"#555\"/>\n" +
+		"    </marker>\n  </defs>\n")
+	w.printf("  <g class=\"edges\" fill=\"none\" stroke=\"#555\">\n")
+	for _, e := range layout.Edges {
+		var path strings.Builder
+		for i, p := range e.Points {
+			if i == 0 {
+				path.WriteString("M ")
+			} else {
+				path.WriteString(" L ")
+			}
+			path.WriteString(svgNumber(p.X) + " " + svgNumber(p.Y))
+		}
+		w.printf("    <path d=\"%s\" marker-end=\"url(#arrow)\"><title>%s</title></path>\n", path.String(),
+			escapeXML(e.Source+" -> "+e.Target))
+		if e.Label != "" {
+			middle := e.Points[len(e.Points)/2]
+			if len(e.Points)%2 == 0 {
+				previous := e.Points[len(e.Points)/2-1]
+				middle = Point{(previous.X + middle.X) / 2, (previous.Y + middle.Y) / 2}
+			}
+			w.printf("    <text x=\"%s\" y=\"%s\" dx=\"4\" fill=\"#555\" stroke=\"none\">%s</text>\n",
+				svgNumber(middle.X), svgNumber(middle.Y), escapeXML(singleLine(e.Label)))
+		}
+	}
+	w.printf("  </g>\n  <g class=\"nodes\">\n")
+	for _, n := range layout.Nodes {
+		w.printf("    <g>\n      <title>%s</title>\n", escapeXML(n.Name))
+		w.printf("      <rect x=\"%s\" y=\"%s\" width=\"%s\" height=\"%s\" rx=\"4\" fill=\"#fff\" stroke=\"#333\"/>\n",
+			svgNumber(n.X), svgNumber(n.Y), svgNumber(n.Width), svgNumber(n.Height))
+		w.printf("      <text x=\"%s\" y=\"%s\" text-anchor=\"middle\" dominant-baseline=\"central\">%s</text>\n",
+			svgNumber(n.X+n.Width/2), svgNumber(n.Y+n.Height/2), escapeXML(singleLine(n.Label)))
+		w.printf("    </g>\n")
+	}
+	w.printf("  </g>\n</svg>\n")
+	return w.err
+}
+
+// svgNumber formats f with at most one decimal place.
+func svgNumber(f float64) string {
+	return strconv.FormatFloat(math.Round(f*10)/10, 'f', -1, 64)
+}
+
+// singleLine replaces the line breaks in s by spaces, as SVG text elements can't contain them.
+func singleLine(s string) string {
+	return strings.Replace(s, "\n", " ", -1)
+}
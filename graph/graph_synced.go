@@ -8,7 +8,7 @@ import (
 	"bufio"
 	"github.com/SimplicityApks/depgrapher/syntax"
 	"runtime"
-	"strings"
+	"sort"
 	"sync"
 )
 
@@ -112,6 +112,43 @@ func (g *Synced) RemoveEdge(source, target string) bool {
 	return g.Graph.RemoveEdge(source, target)
 }
 
+// SetNodeAttribute sets the attribute with the given key of the Node with the given name to value.
+//
+// This operation takes constant time, O(1).
+func (g *Synced) SetNodeAttribute(name, key, value string) {
+	g.Lock()
+	defer g.Unlock()
+	g.Graph.SetNodeAttribute(name, key, value)
+}
+
+// NodeAttributes returns a copy of the attributes of the Node with the given name, or nil if it doesn't have any.
+//
+// This operation takes time proportional to the number of attributes of the Node.
+func (g *Synced) NodeAttributes(name string) map[string]string {
+	g.RLock()
+	defer g.RUnlock()
+	return g.Graph.NodeAttributes(name)
+}
+
+// SetEdgeAttribute sets the attribute with the given key of the edge from the source Node to the target Node to value.
+//
+// This operation takes constant time, O(1).
+func (g *Synced) SetEdgeAttribute(source, target, key, value string) {
+	g.Lock()
+	defer g.Unlock()
+	g.Graph.SetEdgeAttribute(source, target, key, value)
+}
+
+// EdgeAttributes returns a copy of the attributes of the edge from the source Node to the target Node, or nil if it
+// doesn't have any.
+//
+// This operation takes time proportional to the number of attributes of the edge.
+func (g *Synced) EdgeAttributes(source, target string) map[string]string {
+	g.RLock()
+	defer g.RUnlock()
+	return g.Graph.EdgeAttributes(source, target)
+}
+
 // GetDependencies returns a slice containing all dependencies of the Node with the given string.
 // The graph.Synced contains an edge from the Node to each item in the returned dependencies.
 //
@@ -141,6 +178,16 @@ func (g *Synced) Copy() Interface {
 	return &Synced{Graph: *g.Graph.Copy().(*Graph)}
 }
 
+// Replace replaces all nodes, edges and attributes of g with the ones of graph, e.g. to swap in a freshly parsed graph
+// while g is in use. graph must not be used afterwards.
+//
+// This operation takes constant time, O(1).
+func (g *Synced) Replace(graph *Graph) {
+	g.Lock()
+	defer g.Unlock()
+	g.Graph = *graph
+}
+
 // GetDependencyGraph builds the dependency graph for the node. Returns nil if no node with the given name was found in g.
 // If read/write access to the dependency graph shall be thread-safe as well you need to embed it in a Synced!
 //
@@ -151,24 +198,47 @@ func (g *Synced) GetDependencyGraph(nodename string) *Graph {
 	return g.Graph.GetDependencyGraph(nodename)
 }
 
-// FromScanner reads data from the given scanner, building up the dependency tree.
-// This uses multiple workers to concurrently write the read edges.
+// FromScanner reads data from the given scanner, building up the dependency tree and storing recipes and the positions
+// of the prerequisites like Graph.FromScanner. This uses multiple workers to concurrently write the read edges, so the
+// declaration order of the nodes may differ from the input. Use graph.Sorted to get a deterministic order.
 func (g *Synced) FromScanner(scanner *bufio.Scanner, syntaxes ...*syntax.Syntax) (*Synced, error) {
 	if len(syntaxes) == 0 {
 		panic("FromScanner: At least one syntax required!")
 	}
 	scanner.Split(scanLineWithEscape)
 	activeSyntaxes := make(map[*syntax.Syntax]struct{}, len(syntaxes))
-	addEdge := func(s string, t string) { g.AddEdgeAndNodes(node(s), node(t)) }
+	addEdge := func(s string, t string, recipes bool, line, index int, orderOnly bool) {
+		g.Lock()
+		defer g.Unlock()
+		g.Graph.addPrerequisite(s, t, recipes, line, index, orderOnly)
+	}
+	addNode := func(s string) { g.AddNodes(node(s)) }
 	// for running concurrently, we'll add a pool of worker goroutines
 	numWorkers := runtime.GOMAXPROCS(0)
+	// the workers collect the rules with recipes by line number, which are only stored in the order of the lines once
+	// all workers finished, so a later recipe for the same node replaces the earlier one like in Graph.FromScanner
+	var rulesLock sync.Mutex
+	rules := map[int]recipeRule{}
+	defer func() {
+		numbers := make([]int, 0, len(rules))
+		for number := range rules {
+			numbers = append(numbers, number)
+		}
+		sort.Ints(numbers)
+		for _, number := range numbers {
+			rule := rules[number]
+			rule.setRecipe(g.SetNodeAttribute)
+		}
+	}()
 	// we need to wait for our goroutines to finish
 	waitGroup := sync.WaitGroup{}
 	waitGroup.Add(numWorkers)
 	defer waitGroup.Wait()
 	type Task struct {
 		line   string
+		number int
 		syntax *syntax.Syntax
+		recipe []string
 	}
 	tasks := make(chan Task, numWorkers)
 	defer close(tasks)
@@ -176,33 +246,73 @@ func (g *Synced) FromScanner(scanner *bufio.Scanner, syntaxes ...*syntax.Syntax)
 		go func() {
 			defer waitGroup.Done()
 			for task := range tasks {
-				scanDependencies(task.line, task.syntax, addEdge)
+				rule := recipeRule{syntax: task.syntax, recipe: task.recipe}
+				scanDependencies(task.line, task.syntax, func(s string, t string, index int, orderOnly bool) {
+					addEdge(s, t, task.syntax.RecipePrefix != "", task.number, index, orderOnly)
+					rule.sources = appendSource(rule.sources, s)
+				}, func(s string) {
+					addNode(s)
+					rule.sources = appendSource(rule.sources, s)
+				})
+				if len(rule.recipe) > 0 {
+					rulesLock.Lock()
+					rules[task.number] = rule
+					rulesLock.Unlock()
+				}
 			}
 		}()
 	}
+	// the last dependency line of a syntax with a RecipePrefix is only sent after its recipe lines
+	var pending *Task
+	var rule recipeRule
+	lineNumber := 0
 	for scanner.Scan() {
 		if scanner.Err() != nil {
 			return g, scanner.Err()
 		}
 		line := scanner.Text()
+		lineNumber++
+		if rule.addRecipeLine(line) {
+			continue
+		}
+		if pending != nil {
+			pending.recipe, rule = rule.recipe, recipeRule{}
+			tasks <- *pending
+			pending = nil
+		}
 		for _, syntax := range syntaxes {
-			if strings.Contains(line, syntax.GraphPrefix) {
+			if syntax.Index(line, syntax.GraphPrefix) >= 0 {
 				activeSyntaxes[syntax] = struct{}{}
 			} else if _, active := activeSyntaxes[syntax]; !active {
 				continue
 			}
-			if syntax.GraphSuffix != "" && strings.Contains(line, syntax.GraphSuffix) {
+			if syntax.GraphSuffix != "" && syntax.Index(line, syntax.GraphSuffix) >= 0 {
 				delete(activeSyntaxes, syntax)
 			}
-			prefIndex := strings.Index(line, syntax.EdgePrefix)
-			infixIndex := strings.Index(line, syntax.EdgeInfix)
-			suffixIndex := strings.LastIndex(line, syntax.EdgeSuffix)
+			prefIndex := syntax.Index(line, syntax.EdgePrefix)
+			infixIndex := syntax.Index(line, syntax.EdgeInfix)
+			suffixIndex := syntax.LastIndex(line, syntax.EdgeSuffix)
 			if prefIndex >= 0 && infixIndex >= 0 && suffixIndex >= 0 {
-				tasks <- Task{line[prefIndex+len(syntax.EdgePrefix) : suffixIndex], syntax}
+				task := Task{line: line[prefIndex+len(syntax.EdgePrefix) : suffixIndex], number: lineNumber, syntax: syntax}
+				if syntax.RecipePrefix == "" {
+					tasks <- task
+				} else {
+					pending, rule = &task, recipeRule{syntax: syntax}
+				}
 				break
+			} else if prefIndex >= 0 && suffixIndex >= prefIndex+len(syntax.EdgePrefix) {
+				// a line declaring a single quoted node without any edges
+				if name := syntax.Trim(line[prefIndex+len(syntax.EdgePrefix) : suffixIndex]); syntax.Quoted(name) {
+					addNode(syntax.Unquote(name))
+					break
+				}
 			}
 		}
 	}
+	if pending != nil {
+		pending.recipe = rule.recipe
+		tasks <- *pending
+	}
 	return g, nil
 }
 
@@ -369,6 +369,41 @@ func TestGraph_Copy(t *testing.T) {
 	}
 }
 
+func TestGraph_Attributes(t *testing.T) {
+	g := setupLevelGraph(TEST_GRAPH_LEVELS)
+	if g.NodeAttributes("1") != nil || g.EdgeAttributes("1", "2") != nil {
+		t.Error("Attributes returned attributes for a fresh graph")
+	}
+	g.SetNodeAttribute("1", "label", "one")
+	g.SetEdgeAttribute("1", "2", "color", "red")
+	if g.NodeAttributes("1")["label"] != "one" || g.EdgeAttributes("1", "2")["color"] != "red" {
+		t.Error("Attributes didn't return the set attributes")
+	}
+	// the returned attributes must be a copy
+	g.NodeAttributes("1")["label"] = "modified"
+	if g.NodeAttributes("1")["label"] != "one" {
+		t.Error("NodeAttributes returned the internal map")
+	}
+	gCopy := g.Copy().(*Graph)
+	depgraph := g.GetDependencyGraph("2")
+	g.RemoveEdge("1", "2")
+	g.AddEdge("1", "2")
+	if g.EdgeAttributes("1", "2") != nil {
+		t.Error("RemoveEdge didn't remove the edge attributes")
+	}
+	g.RemoveNode("1")
+	g.AddNode(intnode(1))
+	if g.NodeAttributes("1") != nil {
+		t.Error("RemoveNode didn't remove the node attributes")
+	}
+	if gCopy.NodeAttributes("1")["label"] != "one" || gCopy.EdgeAttributes("1", "2")["color"] != "red" {
+		t.Error("Copy didn't copy the attributes")
+	}
+	if depgraph.NodeAttributes("1") != nil || depgraph.GetNode("1") != nil {
+		t.Error("GetDependencyGraph contained attributes of a node not in the dependency graph")
+	}
+}
+
 func TestGraph_GetDependencyGraph(t *testing.T) {
 	var levels, level uint = TEST_GRAPH_LEVELS, 0
 	g := setupLevelGraph(levels)
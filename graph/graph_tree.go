@@ -0,0 +1,137 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Contains the indented text renderers of RenderTree.
+package graph
+
+import (
+	"errors"
+	"io"
+)
+
+// ANSI escape codes used to color the indented trees.
+const (
+	ansiReset = "\x1b[0m"
+	ansiRed   = "\x1b[31m"
+	ansiCyan  = "\x1b[36m"
+)
+
+// indentedRenderer holds the state of a single indented RenderTree call.
+type indentedRenderer struct {
+	graph Interface
+	opts  TreeOptions
+	w     *errWriter
+	// expanded is a set that contains the names of all the nodes whose dependencies have already been printed
+	expanded map[string]struct{}
+	// cyclic is a set that contains the names of all the nodes that are part of a cycle, only used with Color
+	cyclic map[string]struct{}
+}
+
+// renderIndentedTree implements RenderTree for IndentStyle and NpmStyle.
+func renderIndentedTree(writer io.Writer, graph Interface, opts TreeOptions) error {
+	if opts.RepeatedMarker == "" {
+		opts.RepeatedMarker = "(*)"
+		if opts.Style == NpmStyle {
+			opts.RepeatedMarker = "deduped"
+		}
+	}
+	r := &indentedRenderer{graph: graph, opts: opts, w: &errWriter{w: writer}, expanded: map[string]struct{}{}}
+	if opts.Color {
+		r.cyclic = map[string]struct{}{}
+		for _, cycle := range Cycles(graph) {
+			for _, n := range cycle {
+				r.cyclic[n.String()] = struct{}{}
+			}
+		}
+	}
+	roots := []string{opts.Root}
+	if opts.Root == "" {
+		if len(graph.GetNodes()) == 0 {
+			r.w.printf("{empty graph}\n")
+			return r.w.err
+		}
+		roots = treeRoots(graph)
+	} else if graph.GetNode(opts.Root) == nil {
+		return errors.New("RenderTree: root node " + opts.Root + " not found")
+	}
+	for _, root := range roots {
+		r.printNode(root, "", 0, true)
+	}
+	return r.w.err
+}
+
+// printNode prints the line of the node with the given name, followed by its dependencies. prefix contains the lines
+// of the ancestors, last is set if the node is the last dependency of its dependant.
+func (r *indentedRenderer) printNode(name, prefix string, depth int, last bool) {
+	dependencies := r.graph.GetDependencies(name)
+	_, repeated := r.expanded[name]
+	expand := len(dependencies) > 0 && !repeated && (r.opts.MaxDepth <= 0 || depth < r.opts.MaxDepth)
+	connector, childPrefix := "", prefix
+	if depth > 0 {
+		connector = r.connector(last)
+		childPrefix += r.indent(!last)
+		if r.opts.Style == NpmStyle {
+			// npm ls shows whether the node has children in the connector
+			if expand {
+				connector += "┬ "
+			} else {
+				connector += "─ "
+			}
+		}
+	}
+	label := r.colored(name)
+	if repeated && len(dependencies) > 0 {
+		label += " " + r.opts.RepeatedMarker
+	}
+	r.w.printf("%s%s%s\n", prefix, connector, label)
+	if !expand {
+		return
+	}
+	r.expanded[name] = struct{}{}
+	for i, dep := range dependencies {
+		r.printNode(dep.String(), childPrefix, depth+1, i == len(dependencies)-1)
+	}
+}
+
+// connector returns the lines connecting a dependency to its dependant.
+func (r *indentedRenderer) connector(last bool) string {
+	switch {
+	case r.opts.Style == NpmStyle && last:
+		return "└─"
+	case r.opts.Style == NpmStyle:
+		return "├─"
+	case last:
+		return "└── "
+	default:
+		return "├── "
+	}
+}
+
+// indent returns the indentation below a dependency, continuing the vertical line if there are more dependencies.
+func (r *indentedRenderer) indent(more bool) string {
+	switch {
+	case r.opts.Style == NpmStyle && more:
+		return "│ "
+	case r.opts.Style == NpmStyle:
+		return "  "
+	case more:
+		return "│   "
+	default:
+		return "    "
+	}
+}
+
+// colored returns name, colored red if the node is part of a cycle or cyan if it is phony when Color is enabled.
+func (r *indentedRenderer) colored(name string) string {
+	if !r.opts.Color {
+		return name
+	}
+	if _, ok := r.cyclic[name]; ok {
+		return ansiRed + name + ansiReset
+	}
+	if IsPhony(r.graph, name) {
+		return ansiCyan + name + ansiReset
+	}
+	return name
+}
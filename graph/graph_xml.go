@@ -0,0 +1,206 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Contains the XML output formats GraphML and GEXF for graph tools like yEd and Gephi.
+package graph
+
+import (
+	"encoding/xml"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WriteGraphML writes the given graph including its attributes to writer in the GraphML format read by yEd and others.
+// The id of each node is its name, the id of each edge is built by edgeID, so they are stable across runs.
+func WriteGraphML(graph Interface, writer io.Writer) error {
+	nodeKeys, edgeKeys := attributeKeys(graph)
+	w := &errWriter{w: writer}
+	w.printf("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	w.printf("<graphml xmlns=\"http://graphml.graphdrawing.org/xmlns\">\n")
+	for i, key := range nodeKeys {
+		w.printf("  <key id=\"n%d\" for=\"node\" attr.name=\"%s\" attr.type=\"string\"/>\n", i, escapeXML(key))
+	}
+	for i, key := range edgeKeys {
+		w.printf("  <key id=\"e%d\" for=\"edge\" attr.name=\"%s\" attr.type=\"string\"/>\n", i, escapeXML(key))
+	}
+	w.printf("  <graph id=\"G\" edgedefault=\"directed\">\n")
+	attributed, _ := graph.(Attributed)
+	writeData := func(prefix string, keys []string, attrs map[string]string) {
+		for i, key := range keys {
+			if value, ok := attrs[key]; ok {
+				w.printf("      <data key=\"%s%d\">%s</data>\n", prefix, i, escapeXML(value))
+			}
+		}
+	}
+	nodes := graph.GetNodes()
+	for _, n := range nodes {
+		name := n.String()
+		var attrs map[string]string
+		if attributed != nil {
+			attrs = attributed.NodeAttributes(name)
+		}
+		if len(attrs) == 0 {
+			w.printf("    <node id=\"%s\"/>\n", escapeXML(name))
+			continue
+		}
+		w.printf("    <node id=\"%s\">\n", escapeXML(name))
+		writeData("n", nodeKeys, attrs)
+		w.printf("    </node>\n")
+	}
+	for _, n := range nodes {
+		source := n.String()
+		for _, dep := range graph.GetDependencies(source) {
+			target := dep.String()
+			var attrs map[string]string
+			if attributed != nil {
+				attrs = attributed.EdgeAttributes(source, target)
+			}
+			id, s, t := escapeXML(edgeID(source, target)), escapeXML(source), escapeXML(target)
+			if len(attrs) == 0 {
+				w.printf("    <edge id=\"%s\" source=\"%s\" target=\"%s\"/>\n", id, s, t)
+				continue
+			}
+			w.printf("    <edge id=\"%s\" source=\"%s\" target=\"%s\">\n", id, s, t)
+			writeData("e", edgeKeys, attrs)
+			w.printf("    </edge>\n")
+		}
+	}
+	w.printf("  </graph>\n</graphml>\n")
+	return w.err
+}
+
+// WriteGEXF writes the given graph including its attributes to writer in the GEXF 1.3 format read by Gephi.
+// The "label" attributes are written as the native labels, all other attributes as GEXF attribute values.
+// The id of each node is its name, the id of each edge is built by edgeID, so they are stable across runs.
+func WriteGEXF(graph Interface, writer io.Writer) error {
+	nodeKeys, edgeKeys := attributeKeys(graph)
+	nodeKeys, edgeKeys = removeKey(nodeKeys, "label"), removeKey(edgeKeys, "label")
+	w := &errWriter{w: writer}
+	w.printf("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	w.printf("<gexf xmlns=\"http://gexf.net/1.3\" version=\"1.3\">\n")
+	w.printf("  <graph defaultedgetype=\"directed\" mode=\"static\">\n")
+	writeDeclarations := func(class string, keys []string) {
+		if len(keys) == 0 {
+			return
+		}
+		w.printf("    <attributes class=\"%s\">\n", class)
+		for i, key := range keys {
+			w.printf("      <attribute id=\"%d\" title=\"%s\" type=\"string\"/>\n", i, escapeXML(key))
+		}
+		w.printf("    </attributes>\n")
+	}
+	writeDeclarations("node", nodeKeys)
+	writeDeclarations("edge", edgeKeys)
+	attributed, _ := graph.(Attributed)
+	// writeElement writes a node or an edge element, whose start tag is opened with the given string
+	writeElement := func(indent, element, start string, keys []string, attrs map[string]string) {
+		var values []string
+		for i, key := range keys {
+			if value, ok := attrs[key]; ok {
+				values = append(values, "<attvalue for=\""+strconv.Itoa(i)+"\" value=\""+escapeXML(value)+"\"/>")
+			}
+		}
+		if len(values) == 0 {
+			w.printf("%s%s/>\n", indent, start)
+			return
+		}
+		w.printf("%s%s>\n%s  <attvalues>\n", indent, start, indent)
+		for _, value := range values {
+			w.printf("%s    %s\n", indent, value)
+		}
+		w.printf("%s  </attvalues>\n%s</%s>\n", indent, indent, element)
+	}
+	nodes := graph.GetNodes()
+	w.printf("    <nodes>\n")
+	for _, n := range nodes {
+		name := n.String()
+		var attrs map[string]string
+		if attributed != nil {
+			attrs = attributed.NodeAttributes(name)
+		}
+		label := name
+		if l, ok := attrs["label"]; ok {
+			label = l
+		}
+		start := "<node id=\"" + escapeXML(name) + "\" label=\"" + escapeXML(label) + "\""
+		writeElement("      ", "node", start, nodeKeys, attrs)
+	}
+	w.printf("    </nodes>\n    <edges>\n")
+	for _, n := range nodes {
+		source := n.String()
+		for _, dep := range graph.GetDependencies(source) {
+			target := dep.String()
+			var attrs map[string]string
+			if attributed != nil {
+				attrs = attributed.EdgeAttributes(source, target)
+			}
+			start := "<edge id=\"" + escapeXML(edgeID(source, target)) + "\" source=\"" + escapeXML(source) +
+				"\" target=\"" + escapeXML(target) + "\""
+			if l, ok := attrs["label"]; ok {
+				start += " label=\"" + escapeXML(l) + "\""
+			}
+			writeElement("      ", "edge", start, edgeKeys, attrs)
+		}
+	}
+	w.printf("    </edges>\n  </graph>\n</gexf>\n")
+	return w.err
+}
+
+// edgeIDEscaper escapes the backslashes and arrows within the node names of an edge id.
+var edgeIDEscaper = strings.NewReplacer(`\`, `\\`, "->", `\->`)
+
+// edgeID returns the id of the edge from source to target as "source->target". Backslashes and arrows within the names
+// are escaped with a backslash, so the ids of different edges never collide, e.g. for the edges "a->b" to "c" and "a"
+// to "b->c".
+func edgeID(source, target string) string {
+	return edgeIDEscaper.Replace(source) + "->" + edgeIDEscaper.Replace(target)
+}
+
+// attributeKeys returns the sorted keys of all node attributes and all edge attributes used in graph.
+func attributeKeys(graph Interface) (nodeKeys, edgeKeys []string) {
+	attributed, ok := graph.(Attributed)
+	if !ok {
+		return nil, nil
+	}
+	nodeSet, edgeSet := map[string]struct{}{}, map[string]struct{}{}
+	for _, n := range graph.GetNodes() {
+		for key := range attributed.NodeAttributes(n.String()) {
+			nodeSet[key] = struct{}{}
+		}
+		for _, dep := range graph.GetDependencies(n.String()) {
+			for key := range attributed.EdgeAttributes(n.String(), dep.String()) {
+				edgeSet[key] = struct{}{}
+			}
+		}
+	}
+	for key := range nodeSet {
+		nodeKeys = append(nodeKeys, key)
+	}
+	for key := range edgeSet {
+		edgeKeys = append(edgeKeys, key)
+	}
+	sort.Strings(nodeKeys)
+	sort.Strings(edgeKeys)
+	return nodeKeys, edgeKeys
+}
+
+// removeKey returns keys without the given key.
+func removeKey(keys []string, key string) []string {
+	result := keys[:0:0]
+	for _, k := range keys {
+		if k != key {
+			result = append(result, k)
+		}
+	}
+	return result
+}
+
+// escapeXML escapes s for use in XML character data and attribute values.
+func escapeXML(s string) string {
+	var builder strings.Builder
+	xml.EscapeText(&builder, []byte(s))
+	return builder.String()
+}
@@ -0,0 +1,190 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"github.com/SimplicityApks/depgrapher/graph"
+	"github.com/SimplicityApks/depgrapher/reader"
+	"github.com/SimplicityApks/depgrapher/syntax"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// stringList is a flag.Value collecting the values of a flag that can be given multiple times.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// inputFlags are the flags shared by all commands reading a graph.
+type inputFlags struct {
+	syntax       string
+	scan         string
+	includePaths stringList
+	packages     bool
+	sort         string
+	include      stringList
+	exclude      stringList
+	collapse     stringList
+	// markPhony makes load replace the special target .PHONY by phony attributes, see graph.MarkPhony
+	markPhony bool
+}
+
+// addInputFlags registers the input flags on fs.
+func addInputFlags(fs *flag.FlagSet) *inputFlags {
+	in := &inputFlags{}
+	fs.StringVar(&in.syntax, "syntax", "Makefile,Dot", "Syntax to be used to parse the files, or JSON")
+	fs.StringVar(&in.scan, "scan", "", "Source languages to scan the given directories for instead of parsing files with -syntax, one of {C, Python, JavaScript}")
+	fs.Var(&in.includePaths, "I", "Include path used to resolve dependencies with -scan, can be given multiple times")
+	fs.BoolVar(&in.packages, "packages", false, "Collapse the modules found with -scan into package-level nodes")
+	fs.StringVar(&in.sort, "sort", "input", "Order of the nodes in the output, one of {input, name, topological}")
+	fs.Var(&in.include, "include", "Only keep the nodes matching the glob pattern, keeping the dependencies between them through removed nodes, can be given multiple times")
+	fs.Var(&in.exclude, "exclude", "Remove the nodes matching the glob pattern, keeping the dependencies between the other nodes through them, can be given multiple times")
+	fs.Var(&in.collapse, "collapse", "Merge the nodes matching a regexp into one node as regexp=>replacement, e.g. 'build/(\\w+)/.*\\.o=>$1 objs', can be given multiple times")
+	return in
+}
+
+// load reads the graph from the given files, or the directories to scan with -scan. Without any files, the graph is
+// read from stdin, or the current directory is scanned. Invalid flags are reported as usage errors, unreadable input
+// as parse errors. The nodes are filtered with -include and -exclude and then collapsed with -collapse, which
+// replaces the special target .PHONY by phony attributes first.
+func (in *inputFlags) load(filenames []string) (*graph.Graph, error) {
+	var order graph.Order
+	switch in.sort {
+	case "input":
+		order = graph.DeclarationOrder
+	case "name":
+		order = graph.NameOrder
+	case "topological":
+		order = graph.TopologicalOrder
+	default:
+		return nil, usageErrorf("invalid sort order: %s", in.sort)
+	}
+	renames := make([]func(string) string, len(in.collapse))
+	for i, collapse := range in.collapse {
+		index := strings.Index(collapse, "=>")
+		if index < 0 {
+			return nil, usageErrorf("invalid collapse rule, expected regexp=>replacement: %s", collapse)
+		}
+		pattern, err := regexp.Compile(collapse[:index])
+		if err != nil {
+			return nil, withCode(exitUsage, err)
+		}
+		renames[i] = graph.RegexpRename(pattern, collapse[index+2:])
+	}
+	var g *graph.Graph
+	var err error
+	if in.scan != "" {
+		readers, parseErr := reader.Parse(in.scan, reader.Options{IncludePaths: in.includePaths, Packages: in.packages})
+		if parseErr != nil {
+			return nil, withCode(exitUsage, parseErr)
+		}
+		if len(filenames) == 0 {
+			filenames = []string{"."}
+		}
+		g, err = scanDirs(filenames, readers...)
+	} else if in.syntax == "JSON" || in.syntax == "json" {
+		g, err = parseJSONFiles(filenames)
+	} else {
+		syntaxes, parseErr := syntax.Parse(in.syntax)
+		if parseErr != nil {
+			return nil, withCode(exitUsage, parseErr)
+		}
+		g, err = parseFiles(filenames, syntaxes...)
+	}
+	if err != nil {
+		return nil, withCode(exitParse, err)
+	}
+	// filtering and collapsing would mix the .PHONY edges up, but keep the phony attributes
+	if in.markPhony || len(in.include) > 0 || len(in.exclude) > 0 || len(in.collapse) > 0 {
+		g.MarkPhony()
+	}
+	if len(in.include) > 0 || len(in.exclude) > 0 {
+		g = graph.Filter(g, func(name string) bool {
+			return (len(in.include) == 0 || matchesAny(in.include, name)) && !matchesAny(in.exclude, name)
+		})
+	}
+	for _, rename := range renames {
+		g = graph.Collapse(g, rename)
+	}
+	if order != graph.DeclarationOrder {
+		g = graph.Sorted(g, order)
+	}
+	return g, nil
+}
+
+// matchesAny returns true if name matches one of the glob patterns.
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if graph.MatchGlob(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseFiles parses the given files, or stdin if there are none, with the given syntaxes and returns the generated
+// graph
+func parseFiles(filenames []string, syntax ...*syntax.Syntax) (g *graph.Graph, err error) {
+	readers := []io.Reader{os.Stdin}
+	if len(filenames) > 0 {
+		readers = make([]io.Reader, len(filenames))
+	}
+	for index, filename := range filenames {
+		file, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		readers[index] = file
+	}
+	scanner := bufio.NewScanner(io.MultiReader(readers...))
+	if g, err = graph.New().FromScanner(scanner, syntax...); err == nil {
+		err = scanner.Err()
+	}
+	return g, err
+}
+
+// parseJSONFiles reads the given files, or stdin if there are none, in the JSON interchange format and returns the
+// generated graph
+func parseJSONFiles(filenames []string) (g *graph.Graph, err error) {
+	result := graph.New()
+	if len(filenames) == 0 {
+		return result.ReadJSON(os.Stdin)
+	}
+	for _, filename := range filenames {
+		file, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		_, err = result.ReadJSON(file)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// scanDirs scans the source files in the given directories with the given readers and returns the generated graph
+func scanDirs(dirnames []string, readers ...reader.Reader) (g *graph.Graph, err error) {
+	result := graph.New()
+	for _, dirname := range dirnames {
+		if _, err = reader.ReadDir(result, dirname, readers...); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,208 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"github.com/SimplicityApks/depgrapher/graph"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// treeStyles maps the supported text output formats to their tree style.
+var treeStyles = map[string]graph.TreeStyle{
+	"ascii": graph.ArtStyle,
+	"tree":  graph.IndentStyle,
+	"npm":   graph.NpmStyle,
+}
+
+// writers maps the supported output formats to the functions writing them.
+var writers = map[string]func(graph.Interface, io.Writer) error{
+	"csv":     graph.WriteCSV,
+	"dot":     graph.WriteDot,
+	"json":    graph.WriteJSON,
+	"graphml": graph.WriteGraphML,
+	"gexf":    graph.WriteGEXF,
+	"html":    graph.WriteHTML,
+	"makefile": func(g graph.Interface, w io.Writer) error {
+		return graph.WriteMakefile(g, w, graph.MakefileOptions{Width: graph.DefaultWidth, Phony: true})
+	},
+	"matrix":   graph.WriteMatrix,
+	"mermaid":  graph.WriteMermaid,
+	"nodes":    graph.WriteNodeTable,
+	"plantuml": graph.WritePlantUML,
+	"svg":      graph.WriteSVG,
+}
+
+// formatNames returns the names of all supported graph output formats, sorted.
+func formatNames() string {
+	var names []string
+	for name := range treeStyles {
+		names = append(names, name)
+	}
+	for name := range writers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// outputFlags are the flags shared by all commands writing a graph.
+type outputFlags struct {
+	format          string
+	outfile         string
+	depth           int
+	color           bool
+	rankDir         string
+	cluster         string
+	styles          stringList
+	graphAttributes stringList
+	watch           bool
+	interval        time.Duration
+}
+
+// addOutfileFlag registers the -outfile flag on fs, which is shared by all commands.
+func addOutfileFlag(fs *flag.FlagSet, outfile *string) {
+	fs.StringVar(outfile, "outfile", "", "File to write the output to instead of stdout")
+}
+
+// addOutputFlags registers the output flags on fs.
+func addOutputFlags(fs *flag.FlagSet) *outputFlags {
+	out := &outputFlags{}
+	fs.StringVar(&out.format, "format", "", "Output format, one of {"+formatNames()+"}. Defaults to dot if -outfile is set, ascii otherwise.")
+	addOutfileFlag(fs, &out.outfile)
+	fs.IntVar(&out.depth, "depth", 0, "Maximum depth of the tree and npm output, 0 for unlimited")
+	fs.BoolVar(&out.color, "color", false, "Highlight phony and cyclic nodes in the tree and npm output with ANSI colors")
+	fs.StringVar(&out.rankDir, "rankdir", "", "Direction of the dot layout, one of {TB, LR, BT, RL}")
+	fs.StringVar(&out.cluster, "cluster", "", "Group the nodes of the dot output into clusters, one of {dir, prefix}")
+	fs.Var(&out.styles, "style", "Attributes of the matching nodes in the dot output as pattern:key=value,..., where pattern is a glob or @phony, can be given multiple times")
+	fs.Var(&out.graphAttributes, "graph-attr", "Attribute of the graph in the dot output as key=value, can be given multiple times")
+	fs.BoolVar(&out.watch, "watch", false, "Keep polling the input files and render again when they change, printing the added and removed nodes and edges to stderr")
+	fs.DurationVar(&out.interval, "interval", time.Second, "Time between polling the input files with -watch")
+	return out
+}
+
+// openOutput returns the file with the given name created for writing, or stdout if the name is "" or "stdout".
+// The returned function closes the file.
+func openOutput(outfile string) (io.Writer, func() error, error) {
+	if outfile == "" || outfile == "stdout" {
+		return os.Stdout, func() error { return nil }, nil
+	}
+	file, err := os.Create(outfile)
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, file.Close, nil
+}
+
+// write writes g in the selected format. root is the root of the tree output, highlight the node highlighted in the
+// dot output, both may be empty.
+func (out *outputFlags) write(g graph.Interface, root, highlight string) error {
+	format := out.format
+	if format == "" {
+		format = "ascii"
+		if out.outfile != "" {
+			format = "dot"
+		}
+	}
+	style, isTree := treeStyles[format]
+	write, ok := writers[format]
+	if !isTree && !ok {
+		return usageErrorf("invalid output format: %s", format)
+	}
+	var dotOpts graph.DotOptions
+	if format == "dot" {
+		var err error
+		if dotOpts, err = out.dotOptions(); err != nil {
+			return err
+		}
+		dotOpts.Highlight = highlight
+	}
+	writer, closeOutput, err := openOutput(out.outfile)
+	if err != nil {
+		return err
+	}
+	switch {
+	case isTree:
+		// only wrap the ascii graph if it is written to the terminal
+		width := 0
+		if writer == os.Stdout {
+			width = graph.TerminalWidth()
+		}
+		opts := graph.TreeOptions{Style: style, Width: width, Root: root, MaxDepth: out.depth, Color: out.color}
+		err = graph.RenderTree(writer, g, opts)
+	case format == "dot":
+		err = graph.WriteDotOptions(g, writer, dotOpts)
+	default:
+		err = write(g, writer)
+	}
+	if closeErr := closeOutput(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// dotOptions returns the graph.DotOptions selected by the dot flags.
+func (out *outputFlags) dotOptions() (graph.DotOptions, error) {
+	opts := graph.DotOptions{RankDir: out.rankDir, GraphAttributes: map[string]string{}}
+	switch out.cluster {
+	case "":
+	case "dir":
+		opts.Cluster = graph.ClusterByDirectory
+	case "prefix":
+		opts.Cluster = graph.ClusterByPrefix(1)
+	default:
+		return opts, usageErrorf("invalid cluster mode: %s", out.cluster)
+	}
+	for _, style := range out.styles {
+		rule, err := parseDotRule(style)
+		if err != nil {
+			return opts, withCode(exitUsage, err)
+		}
+		opts.Rules = append(opts.Rules, rule)
+	}
+	for _, attribute := range out.graphAttributes {
+		key, value, err := parseAttribute(attribute)
+		if err != nil {
+			return opts, withCode(exitUsage, err)
+		}
+		opts.GraphAttributes[key] = value
+	}
+	return opts, nil
+}
+
+// parseDotRule parses a styling rule for the dot output of the form "pattern:key=value,key=value", where the pattern
+// is a glob pattern or "@phony" for all phony targets.
+func parseDotRule(s string) (graph.DotRule, error) {
+	rule := graph.DotRule{Attributes: map[string]string{}}
+	separator := strings.LastIndex(s[:strings.Index(s+"=", "=")], ":")
+	if separator < 0 {
+		return rule, errors.New("invalid style rule, expected pattern:key=value,...: " + s)
+	}
+	if rule.Pattern = s[:separator]; rule.Pattern == "@phony" {
+		rule.Pattern, rule.Phony = "", true
+	}
+	for _, attribute := range strings.Split(s[separator+1:], ",") {
+		key, value, err := parseAttribute(attribute)
+		if err != nil {
+			return rule, err
+		}
+		rule.Attributes[key] = value
+	}
+	return rule, nil
+}
+
+// parseAttribute splits an attribute of the form key=value.
+func parseAttribute(s string) (key, value string, err error) {
+	index := strings.Index(s, "=")
+	if index <= 0 {
+		return "", "", errors.New("invalid attribute, expected key=value: " + s)
+	}
+	return s[:index], s[index+1:], nil
+}
@@ -0,0 +1,489 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Package query implements a small language for selecting nodes and subgraphs of a graph.Interface.
+//
+// A query combines node names and functions with set operators, for example
+//
+//	deps(all) - deps(third_party/*)
+//	rdeps(config.h) & glob(*.o)
+//	path(main, "util header.h")
+//
+// A bare name is a glob pattern as described in graph.MatchGlob and selects all matching nodes, a name in double or
+// single quotes selects the node with exactly that name. The functions are
+//
+//	deps(x[, depth])   the nodes of x and all nodes they depend on, up to depth edges away if given
+//	rdeps(x[, depth])  the nodes of x and all nodes depending on them, up to depth edges away if given
+//	path(x, y)         all nodes on a chain of dependencies from a node of x to a node of y
+//	roots([x])         the nodes of x without dependants in x, x defaults to all nodes
+//	leaves([x])        the nodes of x without dependencies in x, x defaults to all nodes
+//	cycles([x])        the nodes of x that are part of a dependency cycle within x, x defaults to all nodes
+//	glob(pattern)      the nodes matching the pattern, also for patterns without wildcards
+//	nodes()            all nodes
+//
+// The operators are "a + b" and "a | b" for the union, "a & b" for the intersection and "a - b" for the difference
+// of two sets. The intersection binds stronger than the other operators, which are evaluated from left to right.
+// Operators must be separated from names by whitespace or parentheses, as names may contain them.
+package query
+
+import (
+	"fmt"
+	"github.com/SimplicityApks/depgrapher/graph"
+	"strconv"
+	"strings"
+)
+
+// Query is a parsed query that can be evaluated against any graph.
+type Query struct {
+	source string
+	root   expr
+}
+
+// Parse parses the given query.
+func Parse(s string) (*Query, error) {
+	p := &parser{tokens: tokenize(s)}
+	root, err := p.parseUnion()
+	if err == nil && p.peek().kind != tokenEnd {
+		err = p.errorf("unexpected %s", p.peek())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Query{source: s, root: root}, nil
+}
+
+// String returns the source of q.
+func (q *Query) String() string {
+	return q.source
+}
+
+// Select returns the nodes of g selected by q, in the order of g.GetNodes().
+func (q *Query) Select(g graph.Interface) []graph.Node {
+	selected := q.root.eval(g)
+	var result []graph.Node
+	for _, n := range g.GetNodes() {
+		if _, ok := selected[n.String()]; ok {
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+// Subgraph returns the nodes of g selected by q and the edges between them as a new graph.
+func (q *Query) Subgraph(g graph.Interface) *graph.Graph {
+	return graph.Subgraph(g, q.Select(g))
+}
+
+// set is a set of node names.
+type set map[string]struct{}
+
+// expr is a node of the syntax tree of a query.
+type expr interface {
+	eval(g graph.Interface) set
+}
+
+// nameExpr selects the nodes matching a glob pattern, or the node with exactly the given name.
+type nameExpr struct {
+	pattern string
+	exact   bool
+}
+
+func (e *nameExpr) eval(g graph.Interface) set {
+	result := set{}
+	if e.exact {
+		if g.GetNode(e.pattern) != nil {
+			result[e.pattern] = struct{}{}
+		}
+		return result
+	}
+	for _, n := range g.GetNodes() {
+		if graph.MatchGlob(e.pattern, n.String()) {
+			result[n.String()] = struct{}{}
+		}
+	}
+	return result
+}
+
+// binaryExpr combines the results of two expressions with a set operator.
+type binaryExpr struct {
+	operator    string
+	left, right expr
+}
+
+func (e *binaryExpr) eval(g graph.Interface) set {
+	left, right := e.left.eval(g), e.right.eval(g)
+	result := set{}
+	switch e.operator {
+	case "+", "|":
+		for name := range left {
+			result[name] = struct{}{}
+		}
+		for name := range right {
+			result[name] = struct{}{}
+		}
+	case "&":
+		for name := range left {
+			if _, ok := right[name]; ok {
+				result[name] = struct{}{}
+			}
+		}
+	case "-":
+		for name := range left {
+			if _, ok := right[name]; !ok {
+				result[name] = struct{}{}
+			}
+		}
+	}
+	return result
+}
+
+// callExpr calls a function with the results of its arguments.
+type callExpr struct {
+	function *function
+	args     []expr
+	// depth is the optional numeric argument of deps and rdeps, -1 if it wasn't given
+	depth int
+}
+
+func (e *callExpr) eval(g graph.Interface) set {
+	args := make([]set, len(e.args))
+	for i, arg := range e.args {
+		args[i] = arg.eval(g)
+	}
+	return e.function.eval(g, args, e.depth)
+}
+
+// function is a function of the query language, taking minArgs to maxArgs sets as arguments. If depth is set, the
+// function takes a depth as optional last argument.
+type function struct {
+	minArgs, maxArgs int
+	depth            bool
+	eval             func(g graph.Interface, args []set, depth int) set
+}
+
+var functions = map[string]*function{
+	"deps": {1, 1, true, func(g graph.Interface, args []set, depth int) set {
+		return reach(args[0], g.GetDependencies, depth)
+	}},
+	"rdeps": {1, 1, true, func(g graph.Interface, args []set, depth int) set {
+		return reach(args[0], g.GetDependants, depth)
+	}},
+	"path": {2, 2, false, func(g graph.Interface, args []set, depth int) set {
+		result := reach(args[0], g.GetDependencies, -1)
+		dependants := reach(args[1], g.GetDependants, -1)
+		for name := range result {
+			if _, ok := dependants[name]; !ok {
+				delete(result, name)
+			}
+		}
+		return result
+	}},
+	"roots": {0, 1, false, func(g graph.Interface, args []set, depth int) set {
+		return filter(g, args, func(name string, within set) bool { return !containsAny(g.GetDependants(name), within) })
+	}},
+	"leaves": {0, 1, false, func(g graph.Interface, args []set, depth int) set {
+		return filter(g, args, func(name string, within set) bool { return !containsAny(g.GetDependencies(name), within) })
+	}},
+	"cycles": {0, 1, false, func(g graph.Interface, args []set, depth int) set {
+		nodes := filter(g, args, func(string, set) bool { return true })
+		var selected []graph.Node
+		for _, n := range g.GetNodes() {
+			if _, ok := nodes[n.String()]; ok {
+				selected = append(selected, n)
+			}
+		}
+		result := set{}
+		for _, cycle := range graph.Cycles(graph.Subgraph(g, selected)) {
+			for _, n := range cycle {
+				result[n.String()] = struct{}{}
+			}
+		}
+		return result
+	}},
+	"nodes": {0, 0, false, func(g graph.Interface, args []set, depth int) set {
+		return filter(g, nil, func(string, set) bool { return true })
+	}},
+	// glob is handled by the parser, as its argument is a pattern instead of an expression
+	"glob": {1, 1, false, func(g graph.Interface, args []set, depth int) set {
+		return args[0]
+	}},
+}
+
+// reach returns the nodes of start and all nodes reachable from them by calling next up to depth times, or any number
+// of times if depth is negative.
+func reach(start set, next func(string) []graph.Node, depth int) set {
+	result := set{}
+	var current []string
+	for name := range start {
+		result[name] = struct{}{}
+		current = append(current, name)
+	}
+	for level := 0; len(current) > 0 && (depth < 0 || level < depth); level++ {
+		var following []string
+		for _, name := range current {
+			for _, n := range next(name) {
+				if _, ok := result[n.String()]; !ok {
+					result[n.String()] = struct{}{}
+					following = append(following, n.String())
+				}
+			}
+		}
+		current = following
+	}
+	return result
+}
+
+// filter returns the nodes of the optional single argument in args, or all nodes of g without an argument, for which
+// keep returns true. keep is called with the set of nodes it is filtered from.
+func filter(g graph.Interface, args []set, keep func(name string, within set) bool) set {
+	within := set{}
+	if len(args) > 0 {
+		within = args[0]
+	} else {
+		for _, n := range g.GetNodes() {
+			within[n.String()] = struct{}{}
+		}
+	}
+	result := set{}
+	for name := range within {
+		if keep(name, within) {
+			result[name] = struct{}{}
+		}
+	}
+	return result
+}
+
+// containsAny returns true if one of nodes is in s.
+func containsAny(nodes []graph.Node, s set) bool {
+	for _, n := range nodes {
+		if _, ok := s[n.String()]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenKind is the kind of a token of a query.
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenWord
+	tokenString
+	tokenOperator
+	tokenOpen
+	tokenClose
+	tokenComma
+	tokenError
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	start int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEnd:
+		return "end of query"
+	case tokenString:
+		return strconv.Quote(t.text)
+	default:
+		return "'" + t.text + "'"
+	}
+}
+
+// tokenize splits the query s into tokens, ending with a tokenEnd or a tokenError.
+func tokenize(s string) []token {
+	var tokens []token
+	for i := 0; ; {
+		for i < len(s) && strings.ContainsRune(" \t\r\n", rune(s[i])) {
+			i++
+		}
+		if i == len(s) {
+			return append(tokens, token{tokenEnd, "", i})
+		}
+		start := i
+		switch c := s[i]; {
+		case c == '(':
+			tokens = append(tokens, token{tokenOpen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokenClose, ")", i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tokenComma, ",", i})
+			i++
+		case strings.IndexByte("+-&|", c) >= 0:
+			tokens = append(tokens, token{tokenOperator, string(c), i})
+			i++
+		case c == '"' || c == '\'':
+			var text strings.Builder
+			for i++; i < len(s) && s[i] != c; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				text.WriteByte(s[i])
+			}
+			if i == len(s) {
+				return append(tokens, token{tokenError, "unterminated string", start})
+			}
+			i++
+			tokens = append(tokens, token{tokenString, text.String(), start})
+		default:
+			for i < len(s) && !strings.ContainsRune(" \t\r\n(),\"'", rune(s[i])) {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				i++
+			}
+			tokens = append(tokens, token{tokenWord, s[start:i], start})
+		}
+	}
+}
+
+// parser is a recursive descent parser for queries.
+type parser struct {
+	tokens []token
+	next   int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) consume() token {
+	t := p.tokens[p.next]
+	if t.kind != tokenEnd && t.kind != tokenError {
+		p.next++
+	}
+	return t
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	t := p.peek()
+	if t.kind == tokenError {
+		return fmt.Errorf("query: %s at position %d", t.text, t.start+1)
+	}
+	return fmt.Errorf("query: "+format+" at position %d", append(args, t.start+1)...)
+}
+
+// parseUnion parses a sequence of intersections joined by '+', '|' or '-'.
+func (p *parser) parseUnion() (expr, error) {
+	left, err := p.parseIntersection()
+	for err == nil && p.peek().kind == tokenOperator && p.peek().text != "&" {
+		operator := p.consume().text
+		var right expr
+		if right, err = p.parseIntersection(); err == nil {
+			left = &binaryExpr{operator, left, right}
+		}
+	}
+	return left, err
+}
+
+// parseIntersection parses a sequence of primary expressions joined by '&'.
+func (p *parser) parseIntersection() (expr, error) {
+	left, err := p.parsePrimary()
+	for err == nil && p.peek().kind == tokenOperator && p.peek().text == "&" {
+		p.consume()
+		var right expr
+		if right, err = p.parsePrimary(); err == nil {
+			left = &binaryExpr{"&", left, right}
+		}
+	}
+	return left, err
+}
+
+// parsePrimary parses a name, a function call or an expression in parentheses.
+func (p *parser) parsePrimary() (expr, error) {
+	switch t := p.peek(); t.kind {
+	case tokenOpen:
+		p.consume()
+		e, err := p.parseUnion()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokenClose {
+			return nil, p.errorf("expected ')' instead of %s", p.peek())
+		}
+		p.consume()
+		return e, nil
+	case tokenString:
+		p.consume()
+		return &nameExpr{pattern: t.text, exact: true}, nil
+	case tokenWord:
+		p.consume()
+		if p.peek().kind == tokenOpen {
+			return p.parseCall(t)
+		}
+		return wordExpr(t.text), nil
+	default:
+		return nil, p.errorf("expected a name or function instead of %s", t)
+	}
+}
+
+// wordExpr returns the expression for a bare name, which is a glob pattern if it contains wildcards.
+func wordExpr(word string) *nameExpr {
+	if graph.IsGlob(word) {
+		return &nameExpr{pattern: word}
+	}
+	var name strings.Builder
+	for i := 0; i < len(word); i++ {
+		if word[i] == '\\' && i+1 < len(word) {
+			i++
+		}
+		name.WriteByte(word[i])
+	}
+	return &nameExpr{pattern: name.String(), exact: true}
+}
+
+// parseCall parses the arguments of a call of the function with the given name, starting at the opening parenthesis.
+func (p *parser) parseCall(name token) (expr, error) {
+	f, ok := functions[name.text]
+	if !ok {
+		p.next--
+		return nil, p.errorf("unknown function %s", name)
+	}
+	p.consume()
+	call := &callExpr{function: f, depth: -1}
+	for p.peek().kind != tokenClose {
+		if len(call.args) > 0 {
+			if p.peek().kind != tokenComma {
+				return nil, p.errorf("expected ',' or ')' instead of %s", p.peek())
+			}
+			p.consume()
+		}
+		switch {
+		case f.depth && len(call.args) == f.maxArgs && call.depth < 0:
+			t := p.peek()
+			depth, err := strconv.Atoi(t.text)
+			if t.kind != tokenWord || err != nil || depth < 0 {
+				return nil, p.errorf("expected a depth instead of %s", t)
+			}
+			p.consume()
+			call.depth = depth
+			continue
+		case len(call.args) == f.maxArgs:
+			return nil, p.errorf("too many arguments for %s", name)
+		case name.text == "glob":
+			if t := p.peek(); t.kind == tokenWord || t.kind == tokenString {
+				p.consume()
+				call.args = append(call.args, &nameExpr{pattern: t.text})
+				continue
+			}
+			return nil, p.errorf("expected a pattern instead of %s", p.peek())
+		}
+		arg, err := p.parseUnion()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+	}
+	if len(call.args) < f.minArgs {
+		return nil, p.errorf("too few arguments for %s", name)
+	}
+	p.consume()
+	return call, nil
+}
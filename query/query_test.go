@@ -0,0 +1,88 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package query
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/SimplicityApks/depgrapher/graph"
+	"github.com/SimplicityApks/depgrapher/syntax"
+	"strings"
+	"testing"
+)
+
+const testMakefile = `all: app/main.o lib/util.o third-party/zlib.o
+app/main.o: app/main.c config.h lib/util.h
+lib/util.o: lib/util.c config.h lib/util.h
+third-party/zlib.o: third-party/zlib.c
+lib/util.h: lib/a.h
+lib/a.h: lib/b.h
+lib/b.h: lib/a.h
+`
+
+func TestQuery_Select(t *testing.T) {
+	g, _ := graph.New().FromScanner(bufio.NewScanner(strings.NewReader(testMakefile)), syntax.Makefile)
+	queries := []struct {
+		query, expected string
+	}{
+		{"all", "[all]"},
+		{"missing", "[]"},
+		{"lib/*.o", "[lib/util.o]"},
+		{"deps(all) - deps(third-party/*)", "[all app/main.o lib/util.o app/main.c config.h lib/util.h lib/util.c lib/a.h lib/b.h]"},
+		{"rdeps(config.h) & glob(*.o)", "[app/main.o lib/util.o]"},
+		{"deps(app/main.o, 1)", "[app/main.o app/main.c config.h lib/util.h]"},
+		{"rdeps(lib/a.h, 0)", "[lib/a.h]"},
+		{"path(all, lib/util.h)", "[all app/main.o lib/util.o lib/util.h]"},
+		{"path(lib/util.o, app/*)", "[]"},
+		{"roots()", "[all]"},
+		{"leaves()", "[app/main.c config.h lib/util.c third-party/zlib.c]"},
+		{"roots(lib/*) | leaves(lib/*)", "[lib/util.o lib/util.c]"},
+		{"cycles()", "[lib/a.h lib/b.h]"},
+		{"cycles(lib/util.h + lib/a.h)", "[]"},
+		{"nodes() - deps(all)", "[]"},
+		{"deps(all) - deps(lib/util.o) & lib/*", "[all app/main.o third-party/zlib.o app/main.c config.h third-party/zlib.c]"},
+		{"(deps(all) - deps(lib/util.o)) & app/*", "[app/main.o app/main.c]"},
+		{"'third-party/zlib.c' + \"config.h\"", "[config.h third-party/zlib.c]"},
+		{"glob(\"lib/*.h\")", "[lib/util.h lib/a.h lib/b.h]"},
+	}
+	for _, test := range queries {
+		q, err := Parse(test.query)
+		if err != nil {
+			t.Errorf("Parse(%q) returned error: %v", test.query, err)
+			continue
+		}
+		if result := fmt.Sprint(q.Select(g)); result != test.expected {
+			t.Errorf("%q selected %s instead of %s", test.query, result, test.expected)
+		}
+	}
+	q, _ := Parse("rdeps(lib/util.h)")
+	if sub := q.Subgraph(g); sub.String() != "all => app/main.o; all => lib/util.o; app/main.o => lib/util.h; "+
+		"lib/util.o => lib/util.h; " {
+		t.Errorf("Subgraph returned\n%s", sub)
+	}
+}
+
+func TestParse_errors(t *testing.T) {
+	queries := map[string]string{
+		"":                  "query: expected a name or function instead of end of query at position 1",
+		"deps(all":          "query: expected ',' or ')' instead of end of query at position 9",
+		"deps(all))":        "query: unexpected ')' at position 10",
+		"foo(all)":          "query: unknown function 'foo' at position 1",
+		"deps()":            "query: too few arguments for 'deps' at position 6",
+		"deps(a, b)":        "query: expected a depth instead of 'b' at position 9",
+		"path(a, b, c)":     "query: too many arguments for 'path' at position 12",
+		"deps(app, 1, 2)":   "query: too many arguments for 'deps' at position 14",
+		"rdeps(a, 'b":       "query: unterminated string at position 10",
+		"all - ":            "query: expected a name or function instead of end of query at position 7",
+		"a + 'b":            "query: unterminated string at position 5",
+		"glob(deps(a))":     "query: expected ',' or ')' instead of '(' at position 10",
+		"roots(a) leaves()": "query: unexpected 'leaves' at position 10",
+	}
+	for query, expected := range queries {
+		if _, err := Parse(query); err == nil || err.Error() != expected {
+			t.Errorf("Parse(%q) returned error %v instead of %s", query, err, expected)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package reader
+
+import (
+	"bufio"
+	"github.com/SimplicityApks/depgrapher/graph"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// SystemHeaders is the name of the node that all unresolvable <...> includes are collapsed into.
+const SystemHeaders = "<system headers>"
+
+// includeDirective matches #include "header" and #include <header> lines, capturing the opening bracket and the name.
+var includeDirective = regexp.MustCompile(`^\s*#\s*include\s*([<"])([^>"]+)[>"]`)
+
+// cExtensions are the file extensions scanned by CInclude.
+var cExtensions = map[string]struct{}{
+	".c": {}, ".cc": {}, ".cpp": {}, ".cxx": {}, ".c++": {},
+	".h": {}, ".hh": {}, ".hpp": {}, ".hxx": {}, ".h++": {}, ".inl": {}, ".ipp": {},
+}
+
+// CInclude is a Reader for C and C++ files that adds edges from each file to the headers it #includes.
+//
+// Quoted includes are resolved relative to the including file first, then against the IncludePaths, while
+// angle-bracket includes are only resolved against the IncludePaths. Unresolvable angle-bracket includes are collapsed
+// into the single SystemHeaders node, unresolvable quoted includes keep the name they were included with.
+type CInclude struct {
+	IncludePaths []string
+}
+
+// Matches returns true for C and C++ source and header files.
+func (r *CInclude) Matches(path string) bool {
+	_, ok := cExtensions[strings.ToLower(filepath.Ext(path))]
+	return ok
+}
+
+// ReadFile scans the #include directives of the file at path.
+func (r *CInclude) ReadFile(g *graph.Graph, root, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	source := graph.NewNode(nodeName(root, path))
+	g.AddNodes(source)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		match := includeDirective.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+		g.AddEdgeAndNodes(source, graph.NewNode(r.resolve(root, filepath.Dir(path), match[2], match[1] == "<")))
+	}
+	return scanner.Err()
+}
+
+// resolve returns the node name of the included header.
+func (r *CInclude) resolve(root, dir, header string, system bool) string {
+	if !system {
+		if path := filepath.Join(dir, header); isFile(path) {
+			return nodeName(root, path)
+		}
+	}
+	for _, includePath := range r.IncludePaths {
+		if path := filepath.Join(includePath, header); isFile(path) {
+			return nodeName(root, path)
+		}
+	}
+	if system {
+		return SystemHeaders
+	}
+	return header
+}
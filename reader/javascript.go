@@ -0,0 +1,89 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package reader
+
+import (
+	"github.com/SimplicityApks/depgrapher/graph"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// javaScriptImport matches import ... from '...', import '...', export ... from '...', import('...') and
+// require('...'), capturing the module specifier.
+var javaScriptImport = regexp.MustCompile(`(?:\bfrom|\bimport|\brequire)\s*\(?\s*['"]([^'"\n]+)['"]`)
+
+// javaScriptExtensions are the file extensions scanned by JavaScript, in the order they are tried when resolving.
+var javaScriptExtensions = []string{".ts", ".tsx", ".js", ".jsx", ".mjs", ".cjs"}
+
+// JavaScript is a Reader for JavaScript and TypeScript files that adds edges from each module to the modules it
+// imports or requires.
+//
+// Relative specifiers are resolved to files in the scanned directory tree like node does, trying the known file
+// extensions and index files. Bare specifiers of packages keep their name.
+// If Packages is set, each module is collapsed into the node of its directory, and bare specifiers into their package
+// name, e.g. lodash/fp into lodash.
+type JavaScript struct {
+	Packages bool
+}
+
+// Matches returns true for JavaScript and TypeScript source files.
+func (r *JavaScript) Matches(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range javaScriptExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadFile scans the import statements and require calls of the file at path.
+func (r *JavaScript) ReadFile(g *graph.Graph, root, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	source := nodeName(root, path)
+	if r.Packages {
+		g.AddNodes(graph.NewNode(packageName(source)))
+	} else {
+		g.AddNodes(graph.NewNode(source))
+	}
+	for _, match := range javaScriptImport.FindAllStringSubmatch(string(content), -1) {
+		target, targetPackage := r.resolve(root, filepath.Dir(path), match[1])
+		addModuleEdge(g, source, target, targetPackage, r.Packages)
+	}
+	return nil
+}
+
+// resolve returns the node name and the package node name of the module specifier imported from dir.
+func (r *JavaScript) resolve(root, dir, specifier string) (string, string) {
+	if strings.HasPrefix(specifier, "./") || strings.HasPrefix(specifier, "../") || specifier == "." || specifier == ".." {
+		path := filepath.Join(dir, filepath.FromSlash(specifier))
+		candidates := []string{path}
+		for _, ext := range javaScriptExtensions {
+			candidates = append(candidates, path+ext)
+		}
+		for _, ext := range javaScriptExtensions {
+			candidates = append(candidates, filepath.Join(path, "index"+ext))
+		}
+		for _, candidate := range candidates {
+			if isFile(candidate) {
+				name := nodeName(root, candidate)
+				return name, packageName(name)
+			}
+		}
+		name := nodeName(root, path)
+		return name, packageName(name)
+	}
+	// bare specifier, the package name is the first path element or the first two for scoped packages
+	parts := strings.SplitN(specifier, "/", 3)
+	if strings.HasPrefix(specifier, "@") && len(parts) > 1 {
+		return specifier, parts[0] + "/" + parts[1]
+	}
+	return specifier, parts[0]
+}
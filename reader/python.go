@@ -0,0 +1,145 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package reader
+
+import (
+	"bufio"
+	"github.com/SimplicityApks/depgrapher/graph"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	// pythonImport matches import statements, capturing the imported module list.
+	pythonImport = regexp.MustCompile(`^\s*import\s+(.+)$`)
+	// pythonFromImport matches from ... import statements, capturing the module and the imported name list.
+	pythonFromImport = regexp.MustCompile(`^\s*from\s+(\.*[\w.]*)\s+import\s+(.+)$`)
+)
+
+// Python is a Reader for Python files that adds edges from each module to the modules it imports.
+//
+// Imports are resolved to the .py file or package __init__.py in the scanned directory tree, relative imports are
+// resolved relative to the importing file. Modules that can't be found, like the standard library, keep their dotted
+// module name.
+// If Packages is set, each module is collapsed into the node of its package directory, and unresolved modules into
+// their top-level package.
+type Python struct {
+	Packages bool
+}
+
+// Matches returns true for Python source files.
+func (r *Python) Matches(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".py"
+}
+
+// ReadFile scans the import statements of the file at path.
+func (r *Python) ReadFile(g *graph.Graph, root, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	source := nodeName(root, path)
+	if r.Packages {
+		g.AddNodes(graph.NewNode(packageName(source)))
+	} else {
+		g.AddNodes(graph.NewNode(source))
+	}
+	addImport := func(target, targetPackage string) { addModuleEdge(g, source, target, targetPackage, r.Packages) }
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := stripPythonComment(scanner.Text())
+		if match := pythonFromImport.FindStringSubmatch(line); match != nil {
+			names := match[2]
+			// parenthesized name lists may span multiple lines
+			if strings.HasPrefix(strings.TrimSpace(names), "(") {
+				for !strings.Contains(names, ")") && scanner.Scan() {
+					names += "," + stripPythonComment(scanner.Text())
+				}
+			}
+			r.resolveFrom(root, filepath.Dir(path), match[1], strings.Trim(strings.TrimSpace(names), "()"), addImport)
+		} else if match := pythonImport.FindStringSubmatch(line); match != nil {
+			for _, module := range splitPythonNames(match[1]) {
+				addImport(r.resolve(root, root, module))
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// resolveFrom resolves a from module import names statement, preferring submodules over the module itself.
+func (r *Python) resolveFrom(root, dir, module, names string, addImport func(string, string)) {
+	base := root
+	if dots := len(module) - len(strings.TrimLeft(module, ".")); dots > 0 {
+		base = dir
+		for i := 1; i < dots; i++ {
+			base = filepath.Dir(base)
+		}
+		module = module[dots:]
+	}
+	for _, name := range splitPythonNames(names) {
+		submodule := name
+		if module != "" {
+			submodule = module + "." + name
+		}
+		if name != "*" {
+			if path := findPythonModule(base, submodule); path != "" {
+				addImport(nodeName(root, path), packageName(nodeName(root, path)))
+				continue
+			}
+		}
+		addImport(r.resolve(root, base, module))
+	}
+}
+
+// resolve returns the node name and the package node name of the dotted module, searched for in base.
+func (r *Python) resolve(root, base, module string) (string, string) {
+	if path := findPythonModule(base, module); path != "" {
+		name := nodeName(root, path)
+		return name, packageName(name)
+	}
+	if module == "" {
+		// a relative import of a package without __init__.py
+		name := nodeName(root, base)
+		return name, name
+	}
+	return module, strings.SplitN(module, ".", 2)[0]
+}
+
+// findPythonModule returns the path of the file defining the dotted module in base, or "" if there is none.
+func findPythonModule(base, module string) string {
+	path := base
+	if module != "" {
+		path = filepath.Join(base, filepath.FromSlash(strings.Replace(module, ".", "/", -1)))
+		if isFile(path + ".py") {
+			return path + ".py"
+		}
+	}
+	if init := filepath.Join(path, "__init__.py"); isFile(init) {
+		return init
+	}
+	return ""
+}
+
+// splitPythonNames splits a comma-separated import list, omitting the "as" aliases.
+func splitPythonNames(list string) []string {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		if fields := strings.Fields(strings.Trim(strings.TrimSpace(name), "()\\")); len(fields) > 0 {
+			names = append(names, fields[0])
+		}
+	}
+	return names
+}
+
+// stripPythonComment removes a trailing # comment from the line.
+func stripPythonComment(line string) string {
+	if index := strings.Index(line, "#"); index >= 0 {
+		return line[:index]
+	}
+	return line
+}
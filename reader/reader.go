@@ -0,0 +1,116 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Package reader contains readers that build dependency graphs by scanning source files, as opposed to the line-based
+// build file syntaxes in package syntax.
+// Nodes are named by the slash-separated path of the file relative to the scanned root directory.
+package reader
+
+import (
+	"errors"
+	"github.com/SimplicityApks/depgrapher/graph"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Reader scans single source files for their dependencies.
+type Reader interface {
+	// Matches returns true if the file with the given path should be scanned by this Reader.
+	Matches(path string) bool
+	// ReadFile scans the file at the given path and adds an edge from the file to each of its dependencies to g.
+	// root is the directory that is being scanned, node names are relative to it.
+	ReadFile(g *graph.Graph, root, path string) error
+}
+
+// ReadDir walks the file tree rooted at root and scans every file matched by one of the readers into g.
+// root may also be a single file, which is then scanned relative to its directory.
+func ReadDir(g *graph.Graph, root string, readers ...Reader) (*graph.Graph, error) {
+	if len(readers) == 0 {
+		panic("ReadDir: At least one reader required!")
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return g, err
+	}
+	base := root
+	if !info.IsDir() {
+		base = filepath.Dir(root)
+	}
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		for _, r := range readers {
+			if r.Matches(path) {
+				return r.ReadFile(g, base, path)
+			}
+		}
+		return nil
+	})
+	return g, err
+}
+
+// Options configure the readers returned by Parse.
+type Options struct {
+	// IncludePaths are used to resolve the dependencies of the languages that support them.
+	IncludePaths []string
+	// Packages collapses the modules into package-level nodes for the languages that support it.
+	Packages bool
+}
+
+// Parse returns the readers for the given comma-separated list of language names.
+func Parse(s string, options Options) ([]Reader, error) {
+	var result []Reader
+	for _, name := range strings.Split(s, ",") {
+		switch strings.TrimSpace(name) {
+		case "C", "c", "C++", "c++", "cpp", "cc":
+			result = append(result, &CInclude{IncludePaths: options.IncludePaths})
+		case "Python", "python", "py":
+			result = append(result, &Python{Packages: options.Packages})
+		case "JavaScript", "javascript", "js", "TypeScript", "typescript", "ts":
+			result = append(result, &JavaScript{Packages: options.Packages})
+		default:
+			return result, errors.New("Invalid reader name: " + name)
+		}
+	}
+	return result, nil
+}
+
+// nodeName returns the name of the node for the file at path, relative to root if path lies inside of root.
+func nodeName(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(filepath.Clean(path))
+}
+
+// packageName returns the name of the package node, i.e. the directory, of the module node with the given name.
+func packageName(name string) string {
+	return path.Dir(name)
+}
+
+// addModuleEdge adds an edge from the source module to the target module to g, or from the package of the source to
+// the given target package if packages is set. Edges between modules of the same package are omitted in that case.
+func addModuleEdge(g *graph.Graph, source, target, targetPackage string, packages bool) {
+	if packages {
+		source, target = packageName(source), targetPackage
+		if source == target {
+			g.AddNodes(graph.NewNode(source))
+			return
+		}
+	}
+	g.AddEdgeAndNodes(graph.NewNode(source), graph.NewNode(target))
+}
+
+// isFile returns true if there is a regular file at path.
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
@@ -0,0 +1,171 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package reader
+
+import (
+	"github.com/SimplicityApks/depgrapher/graph"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setupTree creates the given files with their contents in a temporary directory and returns its path.
+func setupTree(t *testing.T, files map[string]string) string {
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestCInclude_ReadFile(t *testing.T) {
+	root := setupTree(t, map[string]string{
+		"src/main.c":       "#include \"util.h\"\n#include <stdio.h>\n  #  include <lib.h>\n#include \"missing.h\"\nint main() {}\n",
+		"src/util.h":       "#include <stdlib.h>\n#include \"../include/lib.h\"\n",
+		"include/lib.h":    "// no includes\n",
+		"include/notes.md": "#include \"util.h\"\n",
+	})
+	g, err := ReadDir(graph.New(), root, &CInclude{IncludePaths: []string{filepath.Join(root, "include")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][2]string{
+		{"src/main.c", "src/util.h"},
+		{"src/main.c", SystemHeaders},
+		{"src/main.c", "include/lib.h"},
+		{"src/main.c", "missing.h"},
+		{"src/util.h", SystemHeaders},
+		{"src/util.h", "include/lib.h"},
+	}
+	for _, e := range expected {
+		if !g.HasEdge(e[0], e[1]) {
+			t.Errorf("ReadDir didn't add edge %s=>%s", e[0], e[1])
+		}
+	}
+	if len(g.GetNodes()) != 5 {
+		t.Errorf("ReadDir returned %d nodes instead of 5: %v", len(g.GetNodes()), g.GetNodes())
+	}
+	if g.GetNode("include/notes.md") != nil {
+		t.Error("ReadDir scanned a file that is not a C file")
+	}
+}
+
+func TestParse(t *testing.T) {
+	if _, err := Parse("cobol", Options{}); err == nil {
+		t.Error("Parse didn't return an error for an invalid reader name")
+	}
+	readers, err := Parse("C,Python,ts", Options{IncludePaths: []string{"include"}})
+	if err != nil || len(readers) != 3 {
+		t.Fatal("Parse didn't return the readers for C, Python and TypeScript")
+	}
+	if !readers[0].Matches("foo/bar.hpp") || readers[0].Matches("foo/bar.py") {
+		t.Error("C reader matched the wrong files")
+	}
+	if !readers[1].Matches("foo/bar.py") || readers[1].Matches("foo/bar.js") {
+		t.Error("Python reader matched the wrong files")
+	}
+	if !readers[2].Matches("foo/bar.tsx") || readers[2].Matches("foo/bar.h") {
+		t.Error("JavaScript reader matched the wrong files")
+	}
+}
+
+func TestPython_ReadFile(t *testing.T) {
+	root := setupTree(t, map[string]string{
+		"app/__init__.py":        "",
+		"app/main.py":            "import os, app.util as u\nfrom app.models import (\n  user,  # users\n  group,\n)\nfrom . import util\n",
+		"app/util.py":            "from .models.user import User\nfrom ..lib import helpers\n",
+		"app/models/__init__.py": "from .user import *\n",
+		"app/models/user.py":     "import json.decoder\n",
+		"app/models/group.py":    "",
+	})
+	g, err := ReadDir(graph.New(), root, &Python{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][2]string{
+		{"app/main.py", "os"},
+		{"app/main.py", "app/util.py"},
+		{"app/main.py", "app/models/user.py"},
+		{"app/main.py", "app/models/group.py"},
+		{"app/util.py", "app/models/user.py"},
+		{"app/util.py", "lib"},
+		{"app/models/__init__.py", "app/models/user.py"},
+		{"app/models/user.py", "json.decoder"},
+	}
+	for _, e := range expected {
+		if !g.HasEdge(e[0], e[1]) {
+			t.Errorf("ReadDir didn't add edge %s=>%s", e[0], e[1])
+		}
+	}
+	if len(g.GetDependencies("app/main.py")) != 4 {
+		t.Errorf("ReadDir added unexpected dependencies: %v", g.GetDependencies("app/main.py"))
+	}
+
+	g, err = ReadDir(graph.New(), root, &Python{Packages: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = [][2]string{
+		{"app", "os"},
+		{"app", "app/models"},
+		{"app/models", "json"},
+	}
+	for _, e := range expected {
+		if !g.HasEdge(e[0], e[1]) {
+			t.Errorf("ReadDir didn't add package edge %s=>%s", e[0], e[1])
+		}
+	}
+	if g.HasEdge("app", "app") || g.HasEdge("app/models", "app/models") {
+		t.Error("ReadDir added an edge from a package to itself")
+	}
+}
+
+func TestJavaScript_ReadFile(t *testing.T) {
+	root := setupTree(t, map[string]string{
+		"src/index.ts":   "import { a } from './a';\nimport b from \"../lib/b\"\nimport React from 'react';\nimport 'lodash/fp';\nconst c = require('./c');\nexport * from '@scope/pkg/sub';\n",
+		"src/a.tsx":      "import {\n  x,\n} from './c/index.js'\n",
+		"src/c/index.js": "module.exports = import('./missing')\n",
+		"lib/b.js":       "",
+		"lib/README.md":  "import x from 'y'",
+	})
+	g, err := ReadDir(graph.New(), root, &JavaScript{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][2]string{
+		{"src/index.ts", "src/a.tsx"},
+		{"src/index.ts", "lib/b.js"},
+		{"src/index.ts", "react"},
+		{"src/index.ts", "lodash/fp"},
+		{"src/index.ts", "src/c/index.js"},
+		{"src/index.ts", "@scope/pkg/sub"},
+		{"src/a.tsx", "src/c/index.js"},
+		{"src/c/index.js", "src/c/missing"},
+	}
+	for _, e := range expected {
+		if !g.HasEdge(e[0], e[1]) {
+			t.Errorf("ReadDir didn't add edge %s=>%s", e[0], e[1])
+		}
+	}
+	if len(g.GetNodes()) != 8 {
+		t.Errorf("ReadDir returned %d nodes instead of 8: %v", len(g.GetNodes()), g.GetNodes())
+	}
+
+	g, err = ReadDir(graph.New(), root, &JavaScript{Packages: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range [][2]string{{"src", "lib"}, {"src", "src/c"}, {"src", "lodash"}, {"src", "@scope/pkg"}} {
+		if !g.HasEdge(e[0], e[1]) {
+			t.Errorf("ReadDir didn't add package edge %s=>%s", e[0], e[1])
+		}
+	}
+}
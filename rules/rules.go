@@ -0,0 +1,207 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Package rules checks dependency graphs against architecture rules, e.g. to enforce layering in continuous
+// integration.
+//
+// A rules file contains one rule per line, empty lines and lines starting with '#' are ignored:
+//
+//	# the library must be usable without the application
+//	lib/* must not depend on app/*
+//	app/* must depend on config.h
+//	nothing depends on deprecated/*
+//	no cycles among pkg/*
+//	no cycles
+//
+// The node sets X and Y are queries as described in package query, so a bare name is a glob pattern and whole
+// expressions like "deps(main) - test/*" can be used. The rules are
+//
+//	X must not depend on Y  no node of X depends on a node of Y directly or indirectly
+//	X must depend on Y      each node of X depends on at least one node of Y directly or indirectly
+//	nothing depends on Y    no node outside of Y directly depends on a node of Y
+//	no cycles among X       the nodes of X don't depend on each other in a cycle, also through other nodes
+//	no cycles               the graph doesn't contain any cycle
+package rules
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/SimplicityApks/depgrapher/graph"
+	"github.com/SimplicityApks/depgrapher/query"
+	"io"
+	"strings"
+)
+
+// kind is the kind of a Rule.
+type kind int
+
+const (
+	forbidden kind = iota
+	required
+	unreferenced
+	acyclic
+)
+
+// Rule is a single rule of a rules file.
+type Rule struct {
+	// Line is the line of the rule in its file, starting at 1
+	Line int
+	// Text is the rule as written in the file
+	Text    string
+	kind    kind
+	subject *query.Query
+	object  *query.Query
+}
+
+// Violation is a violation of a Rule in a graph.
+type Violation struct {
+	Rule *Rule
+	// Path contains the offending nodes, usually a chain of dependencies
+	Path []graph.Node
+	// Message describes the violation if Path doesn't, or is empty
+	Message string
+}
+
+// String returns the rule and the offending path of v.
+func (v Violation) String() string {
+	path := make([]string, len(v.Path))
+	for i, n := range v.Path {
+		path[i] = n.String()
+	}
+	result := v.Rule.Text + ": " + strings.Join(path, " -> ")
+	if v.Message != "" {
+		result += " " + v.Message
+	}
+	return result
+}
+
+// Parse reads the rules from r, returning an error with the line number for the first invalid rule.
+func Parse(r io.Reader) ([]*Rule, error) {
+	var rules []*Rule
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		rule, err := ParseRule(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		rule.Line = line
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// ParseRule parses a single rule.
+func ParseRule(text string) (*Rule, error) {
+	rule := &Rule{Text: text}
+	var subject, object string
+	// split the rule at its verb into the queries before and after it
+	switch {
+	case text == "no cycles":
+		rule.kind = acyclic
+	case strings.HasPrefix(text, "no cycles among "):
+		rule.kind, subject = acyclic, strings.TrimPrefix(text, "no cycles among ")
+	case strings.HasPrefix(text, "nothing depends on "):
+		rule.kind, object = unreferenced, strings.TrimPrefix(text, "nothing depends on ")
+	case strings.Contains(text, " must not depend on "):
+		rule.kind = forbidden
+		subject, object = split(text, " must not depend on ")
+	case strings.Contains(text, " must depend on "):
+		rule.kind = required
+		subject, object = split(text, " must depend on ")
+	default:
+		return nil, fmt.Errorf("invalid rule: %s", text)
+	}
+	var err error
+	if subject != "" {
+		if rule.subject, err = query.Parse(subject); err != nil {
+			return nil, err
+		}
+	}
+	if object != "" {
+		if rule.object, err = query.Parse(object); err != nil {
+			return nil, err
+		}
+	}
+	return rule, nil
+}
+
+// split returns the parts of s before and after the first occurrence of separator.
+func split(s, separator string) (before, after string) {
+	index := strings.Index(s, separator)
+	return s[:index], s[index+len(separator):]
+}
+
+// Check returns the violations of all rules in g, in the order of the rules.
+func Check(g graph.Interface, rules []*Rule) []Violation {
+	var result []Violation
+	for _, rule := range rules {
+		result = append(result, rule.Check(g)...)
+	}
+	return result
+}
+
+// Check returns the violations of rule in g, in the order of g.GetNodes().
+func (rule *Rule) Check(g graph.Interface) []Violation {
+	var result []Violation
+	switch rule.kind {
+	case forbidden:
+		objects := names(rule.object.Select(g))
+		for _, n := range rule.subject.Select(g) {
+			for _, dep := range graph.DependencyClosure(g, n.String()) {
+				if _, ok := objects[dep.String()]; ok && dep.String() != n.String() {
+					path := graph.ShortestPath(g, n.String(), dep.String())
+					result = append(result, Violation{Rule: rule, Path: path})
+				}
+			}
+		}
+	case required:
+		objects := names(rule.object.Select(g))
+	subjects:
+		for _, n := range rule.subject.Select(g) {
+			for _, dep := range graph.DependencyClosure(g, n.String()) {
+				if _, ok := objects[dep.String()]; ok && dep.String() != n.String() {
+					continue subjects
+				}
+			}
+			result = append(result, Violation{Rule: rule, Path: []graph.Node{n}, Message: "depends on none of them"})
+		}
+	case unreferenced:
+		objects := rule.object.Select(g)
+		within := names(objects)
+		for _, n := range objects {
+			for _, dependant := range g.GetDependants(n.String()) {
+				if _, ok := within[dependant.String()]; !ok {
+					result = append(result, Violation{Rule: rule, Path: []graph.Node{dependant, n}})
+				}
+			}
+		}
+	case acyclic:
+		cyclic := graph.Interface(g)
+		if rule.subject != nil {
+			subjects := names(rule.subject.Select(g))
+			cyclic = graph.Filter(g, func(name string) bool {
+				_, ok := subjects[name]
+				return ok
+			})
+		}
+		for _, cycle := range graph.Cycles(cyclic) {
+			start := cycle[0].String()
+			result = append(result, Violation{Rule: rule, Path: graph.ShortestPath(g, start, start)})
+		}
+	}
+	return result
+}
+
+// names returns the set of names of nodes.
+func names(nodes []graph.Node) map[string]struct{} {
+	result := make(map[string]struct{}, len(nodes))
+	for _, n := range nodes {
+		result[n.String()] = struct{}{}
+	}
+	return result
+}
@@ -0,0 +1,91 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package rules
+
+import (
+	"bufio"
+	"github.com/SimplicityApks/depgrapher/graph"
+	"github.com/SimplicityApks/depgrapher/syntax"
+	"strings"
+	"testing"
+)
+
+const testMakefile = `app/main: app/ui lib/core
+app/ui: deprecated/old
+lib/core: lib/util
+lib/util: app/config
+pkg/a: pkg/b
+pkg/b: other
+other: pkg/a
+deprecated/old: deprecated/older
+`
+
+const testRules = `# layering
+lib/* must not depend on app/*
+
+app/* - app/config must depend on lib/*
+nothing depends on deprecated/*
+no cycles among pkg/*
+no cycles among lib/* + app/*
+`
+
+func TestCheck(t *testing.T) {
+	g, _ := graph.New().FromScanner(bufio.NewScanner(strings.NewReader(testMakefile)), syntax.Makefile)
+	rules, err := Parse(strings.NewReader(testRules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 5 || rules[0].Line != 2 || rules[1].Line != 4 {
+		t.Fatalf("Parse returned %d rules", len(rules))
+	}
+	var violations []string
+	for _, violation := range Check(g, rules) {
+		violations = append(violations, violation.String())
+	}
+	expected := []string{
+		"lib/* must not depend on app/*: lib/core -> lib/util -> app/config",
+		"lib/* must not depend on app/*: lib/util -> app/config",
+		"app/* - app/config must depend on lib/*: app/ui depends on none of them",
+		"nothing depends on deprecated/*: app/ui -> deprecated/old",
+		"no cycles among pkg/*: pkg/a -> pkg/b -> other -> pkg/a",
+	}
+	if strings.Join(violations, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Check returned\n%s\ninstead of\n%s", strings.Join(violations, "\n"), strings.Join(expected, "\n"))
+	}
+	if violations := Check(graph.New(), rules); len(violations) != 0 {
+		t.Errorf("Check found violations in an empty graph: %v", violations)
+	}
+}
+
+func TestCheck_phony(t *testing.T) {
+	g, _ := graph.New().FromScanner(bufio.NewScanner(strings.NewReader(
+		"app: deprecated/old\n.PHONY: deprecated/old\n")), syntax.Makefile)
+	g.MarkPhony()
+	rules, err := Parse(strings.NewReader("nothing depends on deprecated/*\n* - app must not depend on *\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var violations []string
+	for _, violation := range Check(g, rules) {
+		violations = append(violations, violation.String())
+	}
+	expected := "nothing depends on deprecated/*: app -> deprecated/old"
+	if strings.Join(violations, "\n") != expected {
+		t.Errorf("Check returned\n%s\ninstead of\n%s", strings.Join(violations, "\n"), expected)
+	}
+}
+
+func TestParse_errors(t *testing.T) {
+	rules := map[string]string{
+		"lib/* may depend on app/*":      "line 1: invalid rule: lib/* may depend on app/*",
+		"\n\nlib/* must depend on deps(": "line 3: query: expected a name or function instead of end of query at position 6",
+		"no cycles among":                "line 1: invalid rule: no cycles among",
+	}
+	for rule, expected := range rules {
+		if _, err := Parse(strings.NewReader(rule)); err == nil || err.Error() != expected {
+			t.Errorf("Parse(%q) returned error %v instead of %s", rule, err, expected)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+// Package server serves the queries of a dependency graph over HTTP, e.g. for editor integrations and dashboards.
+//
+// The endpoints answer with JSON, except for the renders, and with {"error": "..."} and a matching status code if a
+// request fails:
+//
+//	GET  /nodes                   the names of all nodes
+//	GET  /node?name=n             the attributes, dependencies and dependants of the node n
+//	GET  /deps?name=n             the names of all nodes n depends on directly or indirectly
+//	GET  /rdeps?name=n            the names of all nodes depending on n directly or indirectly
+//	GET  /path?from=a&to=b        the names of the nodes of a shortest chain of dependencies from a to b
+//	GET  /cycles                  the dependency cycles as lists of names
+//	GET  /render?format=f&query=q the subgraph selected by the query q, see package query, as dot or svg
+//	POST /reload                  loads the graph again and returns its number of nodes and edges
+//
+// The node names are given as query parameters, so they may contain slashes and relative path elements like "../",
+// which would be cleaned from the paths. Other methods than the given ones are rejected.
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/SimplicityApks/depgrapher/graph"
+	"github.com/SimplicityApks/depgrapher/query"
+	"io"
+	"net/http"
+)
+
+// NodeDetail is the response of the /node endpoint.
+type NodeDetail struct {
+	Name         string            `json:"name"`
+	Phony        bool              `json:"phony"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+	Dependencies []string          `json:"dependencies"`
+	Dependants   []string          `json:"dependants"`
+}
+
+// Server is an http.Handler serving the queries of a graph.
+type Server struct {
+	graph *graph.Synced
+	load  func() (*graph.Graph, error)
+	mux   *http.ServeMux
+}
+
+// New returns a Server serving g. The /reload endpoint replaces the nodes of g with the graph returned by load once the
+// requests being served finished, so each request sees either the previous or the new graph. If load is nil, /reload
+// fails.
+func New(g *graph.Synced, load func() (*graph.Graph, error)) *Server {
+	s := &Server{graph: g, load: load, mux: http.NewServeMux()}
+	s.handle("GET", "/nodes", s.read(s.nodes))
+	s.handle("GET", "/node", s.read(s.node))
+	s.handle("GET", "/deps", s.read(s.closure(graph.DependencyClosure)))
+	s.handle("GET", "/rdeps", s.read(s.closure(graph.DependantClosure)))
+	s.handle("GET", "/path", s.read(s.path))
+	s.handle("GET", "/cycles", s.read(s.cycles))
+	s.handle("GET", "/render", s.read(s.render))
+	s.handle("POST", "/reload", s.reload)
+	return s
+}
+
+// ServeHTTP serves a request to one of the endpoints.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// handle registers h for the requests with the given method to pattern, rejecting other methods.
+func (s *Server) handle(method, pattern string, h http.HandlerFunc) {
+	s.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+			return
+		}
+		h(w, r)
+	})
+}
+
+// handler handles a request with the served graph, which doesn't change while the handler runs.
+type handler func(w http.ResponseWriter, r *http.Request, g *graph.Graph)
+
+// read returns an http.HandlerFunc calling h with the served graph while holding its read lock.
+func (s *Server) read(h handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.graph.RLock()
+		defer s.graph.RUnlock()
+		h(w, r, &s.graph.Graph)
+	}
+}
+
+func (s *Server) nodes(w http.ResponseWriter, r *http.Request, g *graph.Graph) {
+	writeJSON(w, http.StatusOK, names(g.GetNodes()))
+}
+
+func (s *Server) node(w http.ResponseWriter, r *http.Request, g *graph.Graph) {
+	name := r.URL.Query().Get("name")
+	if g.GetNode(name) == nil {
+		writeError(w, http.StatusNotFound, "node %q not found", name)
+		return
+	}
+	writeJSON(w, http.StatusOK, NodeDetail{
+		Name:         name,
+		Phony:        graph.IsPhony(g, name),
+		Attributes:   g.NodeAttributes(name),
+		Dependencies: names(g.GetDependencies(name)),
+		Dependants:   names(g.GetDependants(name)),
+	})
+}
+
+// closure returns a handler writing the names of the nodes returned by closure for the requested node, except the
+// node itself.
+func (s *Server) closure(closure func(graph.Interface, ...string) []graph.Node) handler {
+	return func(w http.ResponseWriter, r *http.Request, g *graph.Graph) {
+		name := r.URL.Query().Get("name")
+		if g.GetNode(name) == nil {
+			writeError(w, http.StatusNotFound, "node %q not found", name)
+			return
+		}
+		result := []string{}
+		for _, n := range closure(g, name) {
+			if n.String() != name {
+				result = append(result, n.String())
+			}
+		}
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+func (s *Server) path(w http.ResponseWriter, r *http.Request, g *graph.Graph) {
+	from, to := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+	for _, name := range []string{from, to} {
+		if g.GetNode(name) == nil {
+			writeError(w, http.StatusNotFound, "node %q not found", name)
+			return
+		}
+	}
+	path := graph.ShortestPath(g, from, to)
+	if path == nil {
+		writeError(w, http.StatusNotFound, "%q doesn't depend on %q", from, to)
+		return
+	}
+	writeJSON(w, http.StatusOK, names(path))
+}
+
+func (s *Server) cycles(w http.ResponseWriter, r *http.Request, g *graph.Graph) {
+	result := [][]string{}
+	for _, cycle := range graph.Cycles(g) {
+		result = append(result, names(cycle))
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) render(w http.ResponseWriter, r *http.Request, g *graph.Graph) {
+	var write func(graph.Interface, io.Writer) error
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "dot":
+		w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+		write = graph.WriteDot
+	case "svg":
+		w.Header().Set("Content-Type", "image/svg+xml")
+		write = graph.WriteSVG
+	default:
+		writeError(w, http.StatusBadRequest, "invalid format %q, expected dot or svg", format)
+		return
+	}
+	subgraph := g
+	if source := r.URL.Query().Get("query"); source != "" {
+		q, err := query.Parse(source)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+		subgraph = q.Subgraph(g)
+	}
+	write(subgraph, w)
+}
+
+func (s *Server) reload(w http.ResponseWriter, r *http.Request) {
+	if s.load == nil {
+		writeError(w, http.StatusNotImplemented, "the graph can't be reloaded")
+		return
+	}
+	// load the graph without holding the lock, so the requests can be served in the meantime
+	g, err := s.load()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	nodes, edges := len(g.GetNodes()), 0
+	for _, n := range g.GetNodes() {
+		edges += len(g.GetDependencies(n.String()))
+	}
+	s.graph.Replace(g)
+	writeJSON(w, http.StatusOK, map[string]int{"nodes": nodes, "edges": edges})
+}
+
+// writeJSON writes v as the JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes the formatted error message as the JSON response with the given status code.
+func writeError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	writeJSON(w, status, map[string]string{"error": fmt.Sprintf(format, args...)})
+}
+
+// names returns the names of nodes.
+func names(nodes []graph.Node) []string {
+	result := make([]string, len(nodes))
+	for i, n := range nodes {
+		result[i] = n.String()
+	}
+	return result
+}
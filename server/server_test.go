@@ -0,0 +1,136 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package server
+
+import (
+	"bufio"
+	"github.com/SimplicityApks/depgrapher/graph"
+	"github.com/SimplicityApks/depgrapher/syntax"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testMakefile = `all: app lib/util.o
+app: app/main.o lib/util.o
+app/main.o: app/main.c lib/util.h
+lib/util.o: lib/util.c lib/util.h
+lib/a.h: lib/b.h
+lib/b.h: lib/a.h
+.PHONY: all
+`
+
+func parse(t *testing.T, makefile string) *graph.Graph {
+	g, err := graph.New().FromScanner(bufio.NewScanner(strings.NewReader(makefile)), syntax.Makefile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.MarkPhony()
+	return g
+}
+
+// get sends a request to server and returns the status code and body of the response.
+func get(t *testing.T, server *httptest.Server, method, path string) (int, string) {
+	request, _ := http.NewRequest(method, server.URL+path, nil)
+	response, err := server.Client().Do(request)
+	if err != nil {
+		t.Error(err)
+		return 0, ""
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	return response.StatusCode, string(body)
+}
+
+func TestServer(t *testing.T) {
+	synced := graph.NewSynced()
+	synced.Replace(parse(t, testMakefile))
+	server := httptest.NewServer(New(synced, nil))
+	defer server.Close()
+	requests := []struct {
+		method, path string
+		status       int
+		expected     string
+	}{
+		{"GET", "/nodes", 200, `["all","app","lib/util.o","app/main.o","app/main.c","lib/util.h","lib/util.c","lib/a.h","lib/b.h"]`},
+		{"GET", "/node?name=all", 200, `{"name":"all","phony":true,"attributes":{"phony":"true"},"dependencies":["app","lib/util.o"],"dependants":[]}`},
+		{"GET", "/node?name=lib/util.h", 200, `{"name":"lib/util.h","phony":false,"dependencies":[],"dependants":["lib/util.o","app/main.o"]}`},
+		{"GET", "/node?name=missing", 404, `{"error":"node \"missing\" not found"}`},
+		{"GET", "/deps?name=app", 200, `["lib/util.o","app/main.o","app/main.c","lib/util.h","lib/util.c"]`},
+		{"GET", "/rdeps?name=lib/util.h", 200, `["all","app","lib/util.o","app/main.o"]`},
+		{"GET", "/path?from=all&to=lib/util.h", 200, `["all","lib/util.o","lib/util.h"]`},
+		{"GET", "/path?from=lib/util.h&to=all", 404, `{"error":"\"lib/util.h\" doesn't depend on \"all\""}`},
+		{"GET", "/cycles", 200, `[["lib/a.h","lib/b.h"]]`},
+		{"GET", "/render?query=deps(lib/util.o)", 200, "digraph{\n\"lib/util.o\"->\"lib/util.h\";\n\"lib/util.o\"->\"lib/util.c\";\n}"},
+		{"GET", "/render?format=png", 400, `{"error":"invalid format \"png\", expected dot or svg"}`},
+		{"POST", "/reload", 501, `{"error":"the graph can't be reloaded"}`},
+		{"POST", "/nodes", 405, `{"error":"method POST not allowed"}`},
+	}
+	for _, request := range requests {
+		status, body := get(t, server, request.method, request.path)
+		if status != request.status || strings.TrimSpace(body) != request.expected {
+			t.Errorf("%s %s returned %d %s", request.method, request.path, status, body)
+		}
+	}
+	if status, body := get(t, server, "GET", "/render?format=svg"); status != 200 || !strings.Contains(body, "<svg") {
+		t.Errorf("GET /render?format=svg returned %d %.50s", status, body)
+	}
+}
+
+func TestServer_relativeNames(t *testing.T) {
+	synced := graph.NewSynced()
+	synced.Replace(parse(t, "./configure: ../include/x.h\nall: ./configure\n"))
+	server := httptest.NewServer(New(synced, nil))
+	defer server.Close()
+	requests := []struct {
+		path, expected string
+	}{
+		{"/node?name=../include/x.h", `{"name":"../include/x.h","phony":false,"dependencies":[],"dependants":["./configure"]}`},
+		{"/deps?name=./configure", `["../include/x.h"]`},
+		{"/rdeps?name=..%2Finclude%2Fx.h", `["./configure","all"]`},
+		{"/path?from=all&to=../include/x.h", `["all","./configure","../include/x.h"]`},
+	}
+	for _, request := range requests {
+		if status, body := get(t, server, "GET", request.path); status != 200 || strings.TrimSpace(body) != request.expected {
+			t.Errorf("GET %s returned %d %s", request.path, status, body)
+		}
+	}
+}
+
+func TestServer_reload(t *testing.T) {
+	synced := graph.NewSynced()
+	synced.Replace(parse(t, testMakefile))
+	reloaded := "all: app\napp: app/main.o\n"
+	server := httptest.NewServer(New(synced, func() (*graph.Graph, error) {
+		return parse(t, reloaded), nil
+	}))
+	defer server.Close()
+	// the reload must not disturb the requests being served
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if status, body := get(t, server, "GET", "/deps?name=all"); status != 200 ||
+					body != "[\"app\",\"lib/util.o\",\"app/main.o\",\"app/main.c\",\"lib/util.h\",\"lib/util.c\"]\n" &&
+						body != "[\"app\",\"app/main.o\"]\n" {
+					t.Errorf("GET /deps?name=all returned %d %s", status, body)
+				}
+			}
+		}()
+	}
+	status, body := get(t, server, "POST", "/reload")
+	wg.Wait()
+	if status != 200 || body != "{\"edges\":2,\"nodes\":3}\n" {
+		t.Errorf("POST /reload returned %d %s", status, body)
+	}
+	if _, body := get(t, server, "GET", "/nodes"); body != "[\"all\",\"app\",\"app/main.o\"]\n" {
+		t.Errorf("GET /nodes returned %s after the reload", body)
+	}
+}
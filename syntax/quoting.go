@@ -0,0 +1,212 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package syntax
+
+import (
+	"strings"
+)
+
+// Quoting defines how node names are quoted and escaped in a Syntax, so that names containing delimiters, whitespace
+// or quotes can be written and read back unchanged.
+type Quoting int
+
+const (
+	// QuoteNone writes names unchanged, which only works for names without any special characters.
+	QuoteNone Quoting = iota
+	// QuoteDouble wraps names in double quotes and escapes double quotes, backslashes and newlines with a backslash,
+	// like the dot language does. Names without quotes are read unchanged.
+	QuoteDouble
+	// EscapeBackslash escapes whitespace, the delimiters and infix of the syntax, '#', ':' and backslashes with a
+	// backslash and '$' as "$$", like make does. Other backslashes are read unchanged, so paths like "src\new.c" keep
+	// them. Newlines can't be represented and are written as escaped spaces.
+	EscapeBackslash
+)
+
+// Quote returns name quoted and escaped according to the Quoting of s.
+func (s *Syntax) Quote(name string) string {
+	switch s.Quoting {
+	case QuoteDouble:
+		return "\"" + strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n").Replace(name) + "\""
+	case EscapeBackslash:
+		var builder strings.Builder
+		for _, r := range name {
+			switch {
+			case r == '\n':
+				builder.WriteString("\\ ")
+			case r == '$':
+				builder.WriteString("$$")
+			case s.escaped(r):
+				builder.WriteByte('\\')
+				builder.WriteRune(r)
+			default:
+				builder.WriteRune(r)
+			}
+		}
+		return builder.String()
+	default:
+		return name
+	}
+}
+
+// Unquote returns the name represented by the given token, reversing Quote.
+func (s *Syntax) Unquote(token string) string {
+	switch s.Quoting {
+	case QuoteDouble:
+		if len(token) < 2 || token[0] != '"' || token[len(token)-1] != '"' {
+			return token
+		}
+		return unescape(token[1 : len(token)-1])
+	case EscapeBackslash:
+		var builder strings.Builder
+		for i := 0; i < len(token); i++ {
+			switch {
+			case token[i] == '\\' && i+1 < len(token) && s.escaped(rune(token[i+1])):
+				i++
+				builder.WriteByte(token[i])
+			case token[i] == '$' && i+1 < len(token) && token[i+1] == '$':
+				i++
+				builder.WriteByte('$')
+			default:
+				builder.WriteByte(token[i])
+			}
+		}
+		return builder.String()
+	default:
+		return token
+	}
+}
+
+// escaped returns true if r is escaped with a backslash by Quote for syntaxes with EscapeBackslash.
+func (s *Syntax) escaped(r rune) bool {
+	return strings.ContainsRune(" \t:#\\", r) || strings.ContainsRune(s.SourceDelimiter, r) ||
+		strings.ContainsRune(s.EdgeInfix, r) || strings.ContainsRune(s.TargetDelimiter, r) ||
+		strings.ContainsRune(s.OrderOnlyDelimiter, r)
+}
+
+// unescape replaces backslash escape sequences in s, with \n standing for a newline.
+func unescape(s string) string {
+	var builder strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			if s[i] == 'n' {
+				builder.WriteByte('\n')
+			} else {
+				builder.WriteByte(s[i])
+			}
+		} else {
+			builder.WriteByte(s[i])
+		}
+	}
+	return builder.String()
+}
+
+// Quoted returns true if token consists of exactly one double-quoted name, for syntaxes with QuoteDouble.
+func (s *Syntax) Quoted(token string) bool {
+	if s.Quoting != QuoteDouble || len(token) < 2 || token[0] != '"' {
+		return false
+	}
+	for i := 1; i < len(token); i++ {
+		switch token[i] {
+		case '\\':
+			i++
+		case '"':
+			return i == len(token)-1
+		}
+	}
+	return false
+}
+
+// Index returns the index of the first instance of substr in line that is neither quoted nor escaped according to
+// the Quoting of s, or -1 if there is none.
+func (s *Syntax) Index(line, substr string) int {
+	if s.Quoting == QuoteNone || substr == "" {
+		return strings.Index(line, substr)
+	}
+	for _, index := range s.indices(line, substr) {
+		return index
+	}
+	return -1
+}
+
+// LastIndex returns the index of the last instance of substr in line that is neither quoted nor escaped according to
+// the Quoting of s, or -1 if there is none.
+func (s *Syntax) LastIndex(line, substr string) int {
+	if s.Quoting == QuoteNone {
+		return strings.LastIndex(line, substr)
+	}
+	if substr == "" {
+		return len(line)
+	}
+	indices := s.indices(line, substr)
+	if len(indices) == 0 {
+		return -1
+	}
+	return indices[len(indices)-1]
+}
+
+// Split slices line into all substrings separated by sep, ignoring quoted and escaped separators according to the
+// Quoting of s. Unlike strings.Split, an empty sep doesn't split line at all.
+func (s *Syntax) Split(line, sep string) []string {
+	if sep == "" {
+		return []string{line}
+	}
+	if s.Quoting == QuoteNone {
+		return strings.Split(line, sep)
+	}
+	var result []string
+	start := 0
+	for _, index := range s.indices(line, sep) {
+		if index >= start {
+			result = append(result, line[start:index])
+			start = index + len(sep)
+		}
+	}
+	return append(result, line[start:])
+}
+
+// Trim returns token without leading and trailing whitespace, keeping escaped trailing whitespace.
+func (s *Syntax) Trim(token string) string {
+	token = strings.TrimLeft(token, " \t")
+	if s.Quoting != EscapeBackslash {
+		return strings.TrimRight(token, " \t")
+	}
+	for end := len(token); end > 0; end-- {
+		if c := token[end-1]; c != ' ' && c != '\t' {
+			return token[:end]
+		}
+		// count the backslashes in front of the whitespace, an odd number escapes it
+		backslashes := 0
+		for i := end - 2; i >= 0 && token[i] == '\\'; i-- {
+			backslashes++
+		}
+		if backslashes%2 == 1 {
+			return token[:end]
+		}
+	}
+	return ""
+}
+
+// indices returns the indices of all instances of substr in line that are neither quoted nor escaped.
+func (s *Syntax) indices(line, substr string) []int {
+	var result []int
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		if !quoted && strings.HasPrefix(line[i:], substr) {
+			result = append(result, i)
+		}
+		switch line[i] {
+		case '\\':
+			if quoted || s.Quoting == EscapeBackslash {
+				i++ // skip the escaped character
+			}
+		case '"':
+			if s.Quoting == QuoteDouble {
+				quoted = !quoted
+			}
+		}
+	}
+	return result
+}
@@ -24,17 +24,26 @@ type Syntax struct {
 	EdgeSuffix      string
 	GraphSuffix     string
 	StripWhitespace bool
+	Quoting         Quoting
+	// OrderOnlyDelimiter separates the normal targets of a line from the order-only ones, like the pipe in make
+	OrderOnlyDelimiter string
+	// RecipePrefix starts the lines following a dependency line that contain the commands building its sources, like
+	// the tab in make
+	RecipePrefix string
 }
 
 var Makefile = &Syntax{
-	GraphPrefix:     "",
-	EdgePrefix:      "",
-	SourceDelimiter: " ",
-	EdgeInfix:       ":",
-	TargetDelimiter: " ",
-	EdgeSuffix:      "",
-	GraphSuffix:     "",
-	StripWhitespace: true,
+	GraphPrefix:        "",
+	EdgePrefix:         "",
+	SourceDelimiter:    " ",
+	EdgeInfix:          ":",
+	TargetDelimiter:    " ",
+	EdgeSuffix:         "",
+	GraphSuffix:        "",
+	StripWhitespace:    true,
+	Quoting:            EscapeBackslash,
+	OrderOnlyDelimiter: "|",
+	RecipePrefix:       "\t",
 }
 
 var MakeCall = []*Syntax{
@@ -69,6 +78,7 @@ var Dot = &Syntax{
 	EdgeSuffix:      ";",
 	GraphSuffix:     "}",
 	StripWhitespace: true,
+	Quoting:         QuoteDouble,
 }
 
 // Parse parses new syntaxes from the given string, supporting various formats.
@@ -100,7 +110,16 @@ func Parse(s string) ([]*Syntax, error) {
 			if len(stringList) != 6 {
 				return result, errors.New("Brackets didn't contain the 7 syntax elements")
 			}
-			result = append(result, &Syntax{stringList[0], stringList[1], stringList[2], stringList[3], stringList[4], stringList[5], stringList[6], true})
+			result = append(result, &Syntax{
+				GraphPrefix:     stringList[0],
+				EdgePrefix:      stringList[1],
+				SourceDelimiter: stringList[2],
+				EdgeInfix:       stringList[3],
+				TargetDelimiter: stringList[4],
+				EdgeSuffix:      stringList[5],
+				GraphSuffix:     stringList[6],
+				StripWhitespace: true,
+			})
 			stringList = make([]string, 0)
 		case '"':
 			endIndex := strings.Index(s, "\"")
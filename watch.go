@@ -0,0 +1,110 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/SimplicityApks/depgrapher/graph"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// clearScreen moves the cursor of the terminal to the top left corner and clears the screen.
+const clearScreen = "\x1b[H\x1b[2J"
+
+// render loads the graph from filenames and passes it to write. With -watch, it keeps polling the files every
+// -interval and loads and writes the graph again whenever they changed, until depgrapher is interrupted. After each
+// reload, the nodes and edges added and removed since the previous graph are printed to stderr. Errors while loading
+// or writing are reported without stopping, except for usage errors.
+func (out *outputFlags) render(in *inputFlags, filenames []string, write func(g *graph.Graph) error) error {
+	if !out.watch {
+		g, err := in.load(filenames)
+		if err != nil {
+			return err
+		}
+		return write(g)
+	}
+	if out.interval <= 0 {
+		return usageErrorf("-interval must be positive, got %v", out.interval)
+	}
+	watched := filenames
+	if len(watched) == 0 {
+		if in.scan == "" {
+			return usageErrorf("-watch can't watch stdin, give the input files")
+		}
+		watched = []string{"."}
+	}
+	toStdout := out.outfile == "" || out.outfile == "stdout"
+	redraw := toStdout && isTerminal(os.Stdout)
+	// the output file may be below a watched directory, but writing it must not trigger another render
+	var excluded string
+	if !toStdout {
+		excluded, _ = filepath.Abs(out.outfile)
+	}
+	var previous *graph.Graph
+	state := ""
+	for ; ; time.Sleep(out.interval) {
+		current := fingerprint(watched, excluded)
+		if current == state {
+			continue
+		}
+		state = current
+		if redraw {
+			fmt.Print(clearScreen)
+		}
+		g, err := in.load(filenames)
+		if err == nil {
+			err = write(g)
+		}
+		var codeErr *exitCodeError
+		if errors.As(err, &codeErr) && codeErr.code == exitUsage {
+			return err
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "depgrapher: %v\n", err)
+			continue
+		}
+		if previous != nil {
+			lines := diffLines(previous, g)
+			fmt.Fprintf(os.Stderr, "depgrapher: %s: %d changes\n", time.Now().Format("15:04:05"), len(lines))
+			for _, line := range lines {
+				fmt.Fprintln(os.Stderr, line)
+			}
+		}
+		previous = g
+	}
+}
+
+// fingerprint returns the paths, sizes and modification times of the given files and all files below the given
+// directories, except the file with the absolute path excluded, so a change of the returned string means that a file
+// was changed, added or removed.
+func fingerprint(filenames []string, excluded string) string {
+	var b strings.Builder
+	for _, filename := range filenames {
+		filepath.WalkDir(filename, func(path string, entry fs.DirEntry, err error) error {
+			if abs, _ := filepath.Abs(path); excluded != "" && abs == excluded {
+				return nil
+			}
+			if err != nil {
+				fmt.Fprintf(&b, "%s: %v\n", path, err)
+				return nil
+			}
+			if info, err := entry.Info(); err == nil && !entry.IsDir() {
+				fmt.Fprintf(&b, "%s %d %d\n", path, info.Size(), info.ModTime().UnixNano())
+			}
+			return nil
+		})
+	}
+	return b.String()
+}
+
+// isTerminal returns true if file is a terminal.
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}